@@ -4,17 +4,24 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
 	authDelivery "github.com/nightnice1st/testGridWhiz/internal/auth/delivery"
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
 	authRepo "github.com/nightnice1st/testGridWhiz/internal/auth/repository"
 	authUsecase "github.com/nightnice1st/testGridWhiz/internal/auth/usecase"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/blobstore"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/config"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/database"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/jwt"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
 	userRepo "github.com/nightnice1st/testGridWhiz/internal/users/repository"
+	userUsecase "github.com/nightnice1st/testGridWhiz/internal/users/usecase"
 	pb "github.com/nightnice1st/testGridWhiz/pb"
 )
 
@@ -33,27 +40,119 @@ func main() {
 
 	// Initialize repositories
 	userRepository := userRepo.NewUserRepository(db)
+	emailChangeRepository := userRepo.NewEmailChangeRepository(db)
 	authRepository := authRepo.NewAuthRepository(db)
 
-	// Initialize rate limiter
-	rateLimiter := ratelimit.NewRateLimiter(cfg.RateLimitAttempts, cfg.RateLimitWindow)
+	// Initialize rate limiter, shared with the other replicas unless it
+	// counts in memory
+	rateLimitStore, err := ratelimit.NewStore(cfg.RateLimitStore, db,
+		ratelimit.NewRedisClient(cfg.RedisAddr, cfg.RedisPassword))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter:", err)
+	}
+	rateLimiter, err := ratelimit.New(cfg.RateLimitAlgorithm, "auth", cfg.RateLimitAttempts, cfg.RateLimitWindow,
+		rateLimitStore)
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter:", err)
+	}
+
+	// Apply the per-method quotas of every call, reloading them when the
+	// file changes
+	quotas, err := ratelimit.NewQuotas(cfg.RateLimitQuotas, cfg.RateLimitAlgorithm, rateLimitStore)
+	if err != nil {
+		log.Fatal("Failed to load rate limit quotas:", err)
+	}
+	if cfg.RateLimitQuotas != "" && cfg.RateLimitReload > 0 {
+		go quotas.RunReloader(cfg.RateLimitReload)
+	}
+
+	// Initialize notifier for out of band messages
+	notifier := notify.New(cfg.Notifier, cfg.NotifierFile)
+
+	// Initialize signing keys
+	var keys jwt.KeySet
+	if cfg.JWTSigningAlg == "" || cfg.JWTSigningAlg == jwt.AlgHS256 {
+		keys = jwt.NewHMACKeyRing(cfg.JWTSecret)
+	} else {
+		keys, err = jwt.NewKeyRing(cfg.JWTSigningAlg, cfg.JWTKeyRotation, cfg.JWTKeyOverlap, cfg.JWTKeysDir)
+		if err != nil {
+			log.Fatal("Failed to load signing keys:", err)
+		}
+	}
 
 	// Initialize use cases
-	authUseCase := authUsecase.NewAuthUsecase(
-		userRepository,
-		authRepository,
-		cfg.JWTSecret,
-		cfg.JWTExpiry,
-		rateLimiter,
-	)
+	authUseCase := authUsecase.NewAuthUsecase(authUsecase.AuthDeps{
+		UserRepo:        userRepository,
+		AuthRepo:        authRepository,
+		Keys:            keys,
+		JWTExpiry:       cfg.JWTExpiry,
+		RefreshExpiry:   cfg.RefreshExpiry,
+		RateLimiter:     rateLimiter,
+		MFAIssuer:       cfg.MFAIssuer,
+		Notifier:        notifier,
+		ResetExpiry:     cfg.PasswordResetTTL,
+		VerifyExpiry:    cfg.EmailVerifyTTL,
+		UnverifiedLogin: cfg.UnverifiedLogin,
+		DeletionGrace:   cfg.DeletionGrace,
+		Lockout: authDomain.LockoutPolicy{
+			Threshold:   cfg.LockoutThreshold,
+			Window:      cfg.LockoutWindow,
+			Duration:    cfg.LockoutDuration,
+			MaxDuration: cfg.LockoutMaxDuration,
+			LockAccount: cfg.LockoutLockAccount,
+		},
+		Challenge: authDomain.ChallengePolicy{
+			AccountFailures: cfg.ChallengeAccountFailures,
+			IPFailures:      cfg.ChallengeIPFailures,
+			SubnetFailures:  cfg.ChallengeSubnetFailures,
+			Window:          cfg.ChallengeWindow,
+			Difficulty:      cfg.ChallengeDifficulty,
+			Expiry:          cfg.ChallengeExpiry,
+		},
+		LoginFailures: ratelimit.NewCounter("login_failures", cfg.ChallengeWindow, rateLimitStore),
+	})
+
+	// Grant the admin role to the configured accounts
+	if err := authUseCase.GrantAdmin(cfg.AdminEmails); err != nil {
+		log.Fatal("Failed to grant admin role:", err)
+	}
+
+	// Permanently delete accounts whose restore window has closed, with
+	// their avatars and the data of both services
+	if cfg.PurgeInterval > 0 {
+		avatarStore, err := blobstore.New(cfg.AvatarStore, cfg.AvatarDir, db, "avatars")
+		if err != nil {
+			log.Fatal("Failed to initialize avatar storage:", err)
+		}
 
-	// Initialize gRPC server
+		accountPurger := userUsecase.NewAccountPurger(userUsecase.PurgerDeps{
+			UserRepo:        userRepository,
+			EmailChangeRepo: emailChangeRepository,
+			Avatars:         avatarStore,
+			Grace:           cfg.DeletionGrace,
+			Purgers:         []userDomain.UserDataPurger{authUseCase},
+		})
+		go accountPurger.RunAccountPurger(cfg.PurgeInterval)
+	}
+
+	// Initialize gRPC server with auth interceptor
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.AuthServicePort))
 	if err != nil {
 		log.Fatal("Failed to listen:", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			authDelivery.AuthInterceptor(authUseCase),
+			ratelimit.QuotaInterceptor(quotas),
+			authDelivery.AuthorizationInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			authDelivery.AuthStreamInterceptor(authUseCase),
+			ratelimit.QuotaStreamInterceptor(quotas),
+			authDelivery.AuthorizationStreamInterceptor(),
+		),
+	)
 
 	// Register service
 	authHandler := authDelivery.NewAuthHandler(authUseCase)
@@ -62,6 +161,17 @@ func main() {
 	// Register reflection service for development
 	reflection.Register(grpcServer)
 
+	// Publish the JWKS document for downstream verifiers
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/.well-known/jwks.json", jwt.JWKSHandler(keys))
+
+		log.Printf("JWKS endpoint starting on port %s", cfg.JWKSHTTPPort)
+		if err := http.ListenAndServe(fmt.Sprintf(":%s", cfg.JWKSHTTPPort), mux); err != nil {
+			log.Fatal("Failed to serve JWKS:", err)
+		}
+	}()
+
 	log.Printf("Auth service starting on port %s", cfg.AuthServicePort)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatal("Failed to serve:", err)
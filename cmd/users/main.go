@@ -8,13 +8,21 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	adminDelivery "github.com/nightnice1st/testGridWhiz/internal/admin/delivery"
+	adminRepo "github.com/nightnice1st/testGridWhiz/internal/admin/repository"
+	adminUsecase "github.com/nightnice1st/testGridWhiz/internal/admin/usecase"
 	authDelivery "github.com/nightnice1st/testGridWhiz/internal/auth/delivery"
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
 	authRepo "github.com/nightnice1st/testGridWhiz/internal/auth/repository"
 	authUsecase "github.com/nightnice1st/testGridWhiz/internal/auth/usecase"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/blobstore"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/config"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/database"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/jwt"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
 	userDelivery "github.com/nightnice1st/testGridWhiz/internal/users/delivery"
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
 	userRepo "github.com/nightnice1st/testGridWhiz/internal/users/repository"
 	userUsecase "github.com/nightnice1st/testGridWhiz/internal/users/usecase"
 	pb "github.com/nightnice1st/testGridWhiz/pb"
@@ -36,20 +44,120 @@ func main() {
 	// Initialize repositories
 	userRepository := userRepo.NewUserRepository(db)
 	authRepository := authRepo.NewAuthRepository(db)
+	emailChangeRepository := userRepo.NewEmailChangeRepository(db)
+	auditRepository := adminRepo.NewAuditRepository(db)
+	attributeRepository := userRepo.NewAttributeSchemaRepository(db)
 
-	// Initialize rate limiter for auth
-	rateLimiter := ratelimit.NewRateLimiter(cfg.RateLimitAttempts, cfg.RateLimitWindow)
+	// Initialize rate limiters for auth and data exports, shared with the
+	// other replicas unless they count in memory
+	rateLimitStore, err := ratelimit.NewStore(cfg.RateLimitStore, db,
+		ratelimit.NewRedisClient(cfg.RedisAddr, cfg.RedisPassword))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter:", err)
+	}
+	rateLimiter, err := ratelimit.New(cfg.RateLimitAlgorithm, "auth", cfg.RateLimitAttempts, cfg.RateLimitWindow,
+		rateLimitStore)
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter:", err)
+	}
+
+	// A fixed window starting with each export keeps exports an interval apart
+	exportLimiter, err := ratelimit.New(ratelimit.FixedWindow, "export", 1, cfg.DataExportInterval, rateLimitStore)
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter:", err)
+	}
+
+	// Apply the per-method quotas of every call, reloading them when the
+	// file changes
+	quotas, err := ratelimit.NewQuotas(cfg.RateLimitQuotas, cfg.RateLimitAlgorithm, rateLimitStore)
+	if err != nil {
+		log.Fatal("Failed to load rate limit quotas:", err)
+	}
+	if cfg.RateLimitQuotas != "" && cfg.RateLimitReload > 0 {
+		go quotas.RunReloader(cfg.RateLimitReload)
+	}
+
+	// Initialize notifier for out of band messages
+	notifier := notify.New(cfg.Notifier, cfg.NotifierFile)
+
+	// Initialize blob storage for uploaded avatars
+	avatarStore, err := blobstore.New(cfg.AvatarStore, cfg.AvatarDir, db, "avatars")
+	if err != nil {
+		log.Fatal("Failed to initialize avatar storage:", err)
+	}
+
+	// Verify tokens against the keys published by the auth service
+	var keys jwt.KeySet
+	if cfg.JWKSURL != "" {
+		keys = jwt.NewRemoteKeySet(cfg.JWKSURL, cfg.JWKSRefresh)
+	} else {
+		keys = jwt.NewHMACKeyRing(cfg.JWTSecret)
+	}
 
 	// Initialize use cases
-	userUseCase := userUsecase.NewUserUsecase(userRepository)
-	authUseCase := authUsecase.NewAuthUsecase(
+	authUseCase := authUsecase.NewAuthUsecase(authUsecase.AuthDeps{
+		UserRepo:        userRepository,
+		AuthRepo:        authRepository,
+		Keys:            keys,
+		JWTExpiry:       cfg.JWTExpiry,
+		RefreshExpiry:   cfg.RefreshExpiry,
+		RateLimiter:     rateLimiter,
+		MFAIssuer:       cfg.MFAIssuer,
+		Notifier:        notifier,
+		ResetExpiry:     cfg.PasswordResetTTL,
+		VerifyExpiry:    cfg.EmailVerifyTTL,
+		UnverifiedLogin: cfg.UnverifiedLogin,
+		DeletionGrace:   cfg.DeletionGrace,
+		Lockout: authDomain.LockoutPolicy{
+			Threshold:   cfg.LockoutThreshold,
+			Window:      cfg.LockoutWindow,
+			Duration:    cfg.LockoutDuration,
+			MaxDuration: cfg.LockoutMaxDuration,
+			LockAccount: cfg.LockoutLockAccount,
+		},
+		Challenge: authDomain.ChallengePolicy{
+			AccountFailures: cfg.ChallengeAccountFailures,
+			IPFailures:      cfg.ChallengeIPFailures,
+			SubnetFailures:  cfg.ChallengeSubnetFailures,
+			Window:          cfg.ChallengeWindow,
+			Difficulty:      cfg.ChallengeDifficulty,
+			Expiry:          cfg.ChallengeExpiry,
+		},
+		LoginFailures: ratelimit.NewCounter("login_failures", cfg.ChallengeWindow, rateLimitStore),
+	})
+	accountPurger := userUsecase.NewAccountPurger(userUsecase.PurgerDeps{
+		UserRepo:        userRepository,
+		EmailChangeRepo: emailChangeRepository,
+		Avatars:         avatarStore,
+		Grace:           cfg.DeletionGrace,
+		Purgers:         []userDomain.UserDataPurger{authUseCase},
+	})
+	adminUseCase := adminUsecase.NewAdminUsecase(
 		userRepository,
-		authRepository,
-		cfg.JWTSecret,
-		cfg.JWTExpiry,
-		rateLimiter,
+		auditRepository,
+		attributeRepository,
+		authUseCase,
+		accountPurger,
 	)
 
+	// Both services hold data about users, which personal data exports
+	// include
+	dataSources := []userDomain.PersonalDataSource{authUseCase, adminUseCase}
+
+	userUseCase := userUsecase.NewUserUsecase(userUsecase.UserDeps{
+		UserRepo:          userRepository,
+		EmailChangeRepo:   emailChangeRepository,
+		AttributeRepo:     attributeRepository,
+		Notifier:          notifier,
+		TokenRevoker:      authUseCase,
+		EmailChangeExpiry: cfg.EmailChangeTTL,
+		Avatars:           avatarStore,
+		AvatarMaxSize:     cfg.AvatarMaxSize,
+		AuditLogger:       adminUseCase,
+		ExportLimiter:     exportLimiter,
+		DataSources:       dataSources,
+	})
+
 	// Initialize gRPC server with auth interceptor
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.UserServicePort))
 	if err != nil {
@@ -57,13 +165,25 @@ func main() {
 	}
 
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(authDelivery.AuthInterceptor(authUseCase)),
+		grpc.ChainUnaryInterceptor(
+			authDelivery.AuthInterceptor(authUseCase),
+			ratelimit.QuotaInterceptor(quotas),
+			authDelivery.AuthorizationInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			authDelivery.AuthStreamInterceptor(authUseCase),
+			ratelimit.QuotaStreamInterceptor(quotas),
+			authDelivery.AuthorizationStreamInterceptor(),
+		),
 	)
 
-	// Register service
+	// Register services
 	userHandler := userDelivery.NewUserHandler(userUseCase)
 	pb.RegisterUserServiceServer(grpcServer, userHandler)
 
+	adminHandler := adminDelivery.NewAdminHandler(adminUseCase)
+	pb.RegisterAdminServiceServer(grpcServer, adminHandler)
+
 	// Register reflection service for development
 	reflection.Register(grpcServer)
 
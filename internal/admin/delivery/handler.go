@@ -0,0 +1,288 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nightnice1st/testGridWhiz/internal/admin/domain"
+	userDelivery "github.com/nightnice1st/testGridWhiz/internal/users/delivery"
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
+	pb "github.com/nightnice1st/testGridWhiz/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdminHandler serves operator actions. Callers are authorized by the
+// permission table of the authorization interceptor.
+type AdminHandler struct {
+	pb.UnimplementedAdminServiceServer
+	adminUsecase domain.AdminUsecase
+}
+
+func NewAdminHandler(adminUsecase domain.AdminUsecase) *AdminHandler {
+	return &AdminHandler{
+		adminUsecase: adminUsecase,
+	}
+}
+
+func (h *AdminHandler) SuspendUser(ctx context.Context, req *pb.SuspendUserRequest) (*pb.SuspendUserResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.adminUsecase.SuspendUser(actorID, req.UserId, req.Reason)
+	if err != nil {
+		code := codes.FailedPrecondition
+		if errors.Is(err, domain.ErrOutranked) {
+			code = codes.PermissionDenied
+		}
+
+		return &pb.SuspendUserResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(code, err.Error())
+	}
+
+	return &pb.SuspendUserResponse{
+		Success: true,
+		Message: "User suspended successfully",
+	}, nil
+}
+
+func (h *AdminHandler) ReinstateUser(ctx context.Context, req *pb.ReinstateUserRequest) (*pb.ReinstateUserResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.adminUsecase.ReinstateUser(actorID, req.UserId)
+	if err != nil {
+		code := codes.FailedPrecondition
+		if errors.Is(err, domain.ErrOutranked) {
+			code = codes.PermissionDenied
+		}
+
+		return &pb.ReinstateUserResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(code, err.Error())
+	}
+
+	return &pb.ReinstateUserResponse{
+		Success: true,
+		Message: "User reinstated successfully",
+	}, nil
+}
+
+func (h *AdminHandler) UnlockUser(ctx context.Context, req *pb.UnlockUserRequest) (*pb.UnlockUserResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.adminUsecase.UnlockUser(actorID, req.UserId)
+	if err != nil {
+		code := codes.FailedPrecondition
+		if errors.Is(err, domain.ErrOutranked) {
+			code = codes.PermissionDenied
+		}
+
+		return &pb.UnlockUserResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(code, err.Error())
+	}
+
+	return &pb.UnlockUserResponse{
+		Success: true,
+		Message: "User unlocked successfully",
+	}, nil
+}
+
+func (h *AdminHandler) ForcePasswordReset(ctx context.Context, req *pb.ForcePasswordResetRequest) (*pb.ForcePasswordResetResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.adminUsecase.ForcePasswordReset(actorID, req.UserId)
+	if err != nil {
+		code := codes.NotFound
+		if errors.Is(err, domain.ErrOutranked) {
+			code = codes.PermissionDenied
+		}
+
+		return &pb.ForcePasswordResetResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(code, err.Error())
+	}
+
+	return &pb.ForcePasswordResetResponse{
+		Success: true,
+		Message: "Password reset forced, the user has been sent a reset token",
+	}, nil
+}
+
+func (h *AdminHandler) AssignRoles(ctx context.Context, req *pb.AssignRolesRequest) (*pb.AssignRolesResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	user, err := h.adminUsecase.AssignRoles(actorID, req.UserId, req.Roles)
+	if err != nil {
+		return &pb.AssignRolesResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.AssignRolesResponse{
+		Success: true,
+		Message: "Roles assigned successfully",
+		User:    userDelivery.ToProtoUser(user),
+	}, nil
+}
+
+func (h *AdminHandler) ListDeletedUsers(ctx context.Context, req *pb.ListDeletedUsersRequest) (*pb.ListDeletedUsersResponse, error) {
+	users, total, err := h.adminUsecase.ListDeletedUsers(int(req.Page), int(req.Limit))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	pbUsers := make([]*pb.User, len(users))
+	for i, user := range users {
+		pbUsers[i] = userDelivery.ToProtoUser(user)
+	}
+
+	return &pb.ListDeletedUsersResponse{
+		Users: pbUsers,
+		Total: int32(total),
+		Page:  req.Page,
+		Limit: req.Limit,
+	}, nil
+}
+
+func (h *AdminHandler) HardDeleteUser(ctx context.Context, req *pb.HardDeleteUserRequest) (*pb.HardDeleteUserResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.adminUsecase.HardDeleteUser(actorID, req.UserId)
+	if err != nil {
+		return &pb.HardDeleteUserResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return &pb.HardDeleteUserResponse{
+		Success: true,
+		Message: "User permanently deleted",
+	}, nil
+}
+
+func (h *AdminHandler) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	events, total, err := h.adminUsecase.ListAuditEvents(req.UserId, int(req.Page), int(req.Limit))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	pbEvents := make([]*pb.AuditEvent, len(events))
+	for i, event := range events {
+		pbEvents[i] = &pb.AuditEvent{
+			Id:        event.ID,
+			ActorId:   event.ActorID,
+			Action:    event.Action,
+			TargetId:  event.TargetID,
+			Details:   event.Details,
+			CreatedAt: event.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	return &pb.ListAuditEventsResponse{
+		Events: pbEvents,
+		Total:  int32(total),
+		Page:   req.Page,
+		Limit:  req.Limit,
+	}, nil
+}
+
+func (h *AdminHandler) ListAttributeDefinitions(ctx context.Context, req *pb.ListAttributeDefinitionsRequest) (*pb.ListAttributeDefinitionsResponse, error) {
+	defs, err := h.adminUsecase.ListAttributeDefinitions()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	pbDefs := make([]*pb.AttributeDefinition, len(defs))
+	for i, def := range defs {
+		pbDefs[i] = &pb.AttributeDefinition{
+			Key:         def.Key,
+			Type:        def.Type,
+			Description: def.Description,
+			MaxLength:   int32(def.MaxLength),
+			Options:     def.Options,
+			UpdatedAt:   def.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	return &pb.ListAttributeDefinitionsResponse{
+		Definitions: pbDefs,
+	}, nil
+}
+
+func (h *AdminHandler) SetAttributeDefinition(ctx context.Context, req *pb.SetAttributeDefinitionRequest) (*pb.SetAttributeDefinitionResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	if req.Definition == nil {
+		return nil, status.Error(codes.InvalidArgument, "definition required")
+	}
+
+	def := &userDomain.AttributeDefinition{
+		Key:         req.Definition.Key,
+		Type:        req.Definition.Type,
+		Description: req.Definition.Description,
+		MaxLength:   int(req.Definition.MaxLength),
+		Options:     req.Definition.Options,
+	}
+
+	err := h.adminUsecase.SetAttributeDefinition(actorID, def)
+	if err != nil {
+		return &pb.SetAttributeDefinitionResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.SetAttributeDefinitionResponse{
+		Success: true,
+		Message: "Attribute definition saved successfully",
+	}, nil
+}
+
+func (h *AdminHandler) DeleteAttributeDefinition(ctx context.Context, req *pb.DeleteAttributeDefinitionRequest) (*pb.DeleteAttributeDefinitionResponse, error) {
+	actorID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.adminUsecase.DeleteAttributeDefinition(actorID, req.Key)
+	if err != nil {
+		return &pb.DeleteAttributeDefinitionResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.DeleteAttributeDefinitionResponse{
+		Success: true,
+		Message: "Attribute definition deleted, the attribute was removed from every profile",
+	}, nil
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionSuspendUser        = "suspend_user"
+	ActionReinstateUser      = "reinstate_user"
+	ActionForcePasswordReset = "force_password_reset"
+	ActionAssignRoles        = "assign_roles"
+	ActionHardDeleteUser     = "hard_delete_user"
+	ActionUnlockUser         = "unlock_user"
+
+	ActionSetAttributeDefinition    = "set_attribute_definition"
+	ActionDeleteAttributeDefinition = "delete_attribute_definition"
+)
+
+// ErrOutranked is returned when an operator acts on an account holding a
+// role they do not hold themselves.
+var ErrOutranked = errors.New("cannot act on a user with roles you do not hold")
+
+// AuditEvent records an operator acting on an account.
+type AuditEvent struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	ActorID   string    `bson:"actor_id" json:"actor_id"`
+	Action    string    `bson:"action" json:"action"`
+	TargetID  string    `bson:"target_id" json:"target_id"`
+	Details   string    `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type AuditRepository interface {
+	Record(event *AuditEvent) error
+	List(targetID string, page, limit int) ([]*AuditEvent, int, error)
+	ListForUser(userID string) ([]*AuditEvent, error)
+}
+
+// AccountSecurity signs users out and forces password resets. It is
+// implemented by the auth usecase.
+type AccountSecurity interface {
+	LogoutAll(userID string) error
+	ForcePasswordReset(userID string) error
+	UnlockAccount(actorID, userID string) error
+}
+
+type AdminUsecase interface {
+	SuspendUser(actorID, userID, reason string) error
+	ReinstateUser(actorID, userID string) error
+	UnlockUser(actorID, userID string) error
+	ForcePasswordReset(actorID, userID string) error
+	AssignRoles(actorID, userID string, roles []string) (*userDomain.User, error)
+	ListDeletedUsers(page, limit int) ([]*userDomain.User, int, error)
+	HardDeleteUser(actorID, userID string) error
+	ListAuditEvents(userID string, page, limit int) ([]*AuditEvent, int, error)
+	ListAttributeDefinitions() ([]*userDomain.AttributeDefinition, error)
+	SetAttributeDefinition(actorID string, def *userDomain.AttributeDefinition) error
+	DeleteAttributeDefinition(actorID, key string) error
+
+	// The admin usecase also serves as the audit log of the user service
+	userDomain.AuditLogger
+	userDomain.PersonalDataSource
+}
@@ -0,0 +1,108 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/admin/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type auditRepository struct {
+	coll *mongo.Collection
+}
+
+func NewAuditRepository(db *mongo.Database) domain.AuditRepository {
+	coll := db.Collection("auditLog")
+
+	// Create indexes for lookups by account and actor
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "actor_id", Value: 1}},
+		},
+	}
+
+	coll.Indexes().CreateMany(ctx, indexes)
+
+	return &auditRepository{
+		coll: coll,
+	}
+}
+
+func (r *auditRepository) Record(event *domain.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event.CreatedAt = time.Now()
+
+	_, err := r.coll.InsertOne(ctx, event)
+	return err
+}
+
+// ListForUser returns every event the user acted in or was the target of,
+// newest first.
+func (r *auditRepository) ListForUser(userID string) ([]*domain.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{{"actor_id": userID}, {"target_id": userID}}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*domain.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// List returns a page of events, newest first. An empty targetID lists the
+// events of every account.
+func (r *auditRepository) List(targetID string, page, limit int) ([]*domain.AuditEvent, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if targetID != "" {
+		filter["target_id"] = targetID
+	}
+
+	// Count total documents
+	total, err := r.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*domain.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+
+	return events, int(total), nil
+}
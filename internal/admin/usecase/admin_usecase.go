@@ -0,0 +1,294 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nightnice1st/testGridWhiz/internal/admin/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/rbac"
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+type adminUsecase struct {
+	userRepo      userDomain.UserRepository
+	auditRepo     domain.AuditRepository
+	attributeRepo userDomain.AttributeSchemaRepository
+	security      domain.AccountSecurity
+	purger        userDomain.AccountPurger
+}
+
+func NewAdminUsecase(userRepo userDomain.UserRepository, auditRepo domain.AuditRepository,
+	attributeRepo userDomain.AttributeSchemaRepository, security domain.AccountSecurity,
+	purger userDomain.AccountPurger) domain.AdminUsecase {
+	return &adminUsecase{
+		userRepo:      userRepo,
+		auditRepo:     auditRepo,
+		attributeRepo: attributeRepo,
+		security:      security,
+		purger:        purger,
+	}
+}
+
+func (u *adminUsecase) SuspendUser(actorID, userID, reason string) error {
+	if actorID == userID {
+		return errors.New("cannot suspend your own account")
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.checkCanManage(actorID, user); err != nil {
+		return err
+	}
+
+	if user.Status == userDomain.StatusSuspended {
+		return errors.New("user is already suspended")
+	}
+
+	change, err := userDomain.NewStatusChange(user, userDomain.StatusSuspended, reason, actorID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.SetStatus(user.ID, change); err != nil {
+		return err
+	}
+
+	// Suspension takes effect on every existing session at once
+	if err := u.security.LogoutAll(user.ID); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionSuspendUser, user.ID, reason)
+}
+
+func (u *adminUsecase) ReinstateUser(actorID, userID string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.checkCanManage(actorID, user); err != nil {
+		return err
+	}
+
+	if user.Status != userDomain.StatusSuspended {
+		return errors.New("user is not suspended")
+	}
+
+	change, err := userDomain.NewStatusChange(user, user.UsableStatus(), "reinstated", actorID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.SetStatus(user.ID, change); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionReinstateUser, user.ID, "")
+}
+
+// UnlockUser lifts a lockout caused by failed logins.
+func (u *adminUsecase) UnlockUser(actorID, userID string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.checkCanManage(actorID, user); err != nil {
+		return err
+	}
+
+	if err := u.security.UnlockAccount(actorID, userID); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionUnlockUser, userID, "")
+}
+
+func (u *adminUsecase) ForcePasswordReset(actorID, userID string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.checkCanManage(actorID, user); err != nil {
+		return err
+	}
+
+	if err := u.security.ForcePasswordReset(userID); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionForcePasswordReset, userID, "")
+}
+
+func (u *adminUsecase) AssignRoles(actorID, userID string, roles []string) (*userDomain.User, error) {
+	if len(roles) == 0 {
+		return nil, errors.New("at least one role is required")
+	}
+
+	for _, role := range roles {
+		if !rbac.ValidRole(role) {
+			return nil, errors.New("unknown role " + role)
+		}
+	}
+
+	// Admins cannot lock themselves out of administration
+	if actorID == userID && !rbac.HasRole(roles, rbac.RoleAdmin) {
+		return nil, errors.New("cannot remove your own admin role")
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if err := u.userRepo.SetRoles(user.ID, roles); err != nil {
+		return nil, err
+	}
+
+	// Roles are carried in tokens, so existing tokens hold the old ones
+	if err := u.security.LogoutAll(user.ID); err != nil {
+		return nil, err
+	}
+
+	if err := u.record(actorID, domain.ActionAssignRoles, user.ID, strings.Join(roles, ",")); err != nil {
+		return nil, err
+	}
+
+	user.Roles = roles
+
+	// Clear password before returning
+	user.Password = ""
+	return user, nil
+}
+
+func (u *adminUsecase) ListDeletedUsers(page, limit int) ([]*userDomain.User, int, error) {
+	page, limit = normalizePage(page, limit)
+
+	users, total, err := u.userRepo.ListDeleted(page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Clear passwords before returning
+	for _, user := range users {
+		user.Password = ""
+	}
+
+	return users, total, nil
+}
+
+// HardDeleteUser permanently removes an account that was already soft
+// deleted, together with everything stored about it.
+func (u *adminUsecase) HardDeleteUser(actorID, userID string) error {
+	if actorID == userID {
+		return errors.New("cannot delete your own account")
+	}
+
+	if _, err := u.userRepo.FindByID(userID); err == nil {
+		return errors.New("only deleted users can be permanently deleted")
+	}
+
+	user, err := u.userRepo.FindDeletedByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.purger.Purge(user); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionHardDeleteUser, userID, "")
+}
+
+func (u *adminUsecase) ListAuditEvents(userID string, page, limit int) ([]*domain.AuditEvent, int, error) {
+	page, limit = normalizePage(page, limit)
+
+	return u.auditRepo.List(userID, page, limit)
+}
+
+func (u *adminUsecase) ListAttributeDefinitions() ([]*userDomain.AttributeDefinition, error) {
+	return u.attributeRepo.List()
+}
+
+// SetAttributeDefinition creates or replaces a custom attribute. Values
+// already stored are not checked against the new definition.
+func (u *adminUsecase) SetAttributeDefinition(actorID string, def *userDomain.AttributeDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+
+	if err := u.attributeRepo.Save(def); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionSetAttributeDefinition, "", def.Key+" ("+def.Type+")")
+}
+
+// DeleteAttributeDefinition removes a custom attribute and its value from
+// every profile.
+func (u *adminUsecase) DeleteAttributeDefinition(actorID, key string) error {
+	if err := u.attributeRepo.Delete(key); err != nil {
+		return errors.New("attribute not found")
+	}
+
+	if err := u.userRepo.RemoveAttribute(key); err != nil {
+		return err
+	}
+
+	return u.record(actorID, domain.ActionDeleteAttributeDefinition, "", key)
+}
+
+func (u *adminUsecase) Audit(actorID, action, targetID, details string) error {
+	return u.record(actorID, action, targetID, details)
+}
+
+// PersonalData returns the audit events involving the user.
+func (u *adminUsecase) PersonalData(user *userDomain.User) (map[string]interface{}, error) {
+	events, err := u.auditRepo.ListForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"audit_events": events}, nil
+}
+
+// checkCanManage refuses actions on a user holding a role the actor does
+// not, so support cannot suspend or take over an admin account.
+func (u *adminUsecase) checkCanManage(actorID string, user *userDomain.User) error {
+	actor, err := u.userRepo.FindByID(actorID)
+	if err != nil {
+		return domain.ErrOutranked
+	}
+
+	if !rbac.CanManage(actor.Roles, user.Roles) {
+		return domain.ErrOutranked
+	}
+
+	return nil
+}
+
+func (u *adminUsecase) record(actorID, action, targetID, details string) error {
+	return u.auditRepo.Record(&domain.AuditEvent{
+		ActorID:  actorID,
+		Action:   action,
+		TargetID: targetID,
+		Details:  details,
+	})
+}
+
+func normalizePage(page, limit int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	return page, limit
+}
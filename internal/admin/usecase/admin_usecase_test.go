@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nightnice1st/testGridWhiz/internal/admin/domain"
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func TestAdminActionsRespectRoles(t *testing.T) {
+	actions := map[string]func(u *adminUsecase, actorID, userID string) error{
+		"SuspendUser": func(u *adminUsecase, actorID, userID string) error {
+			return u.SuspendUser(actorID, userID, "test")
+		},
+		"UnlockUser": func(u *adminUsecase, actorID, userID string) error {
+			return u.UnlockUser(actorID, userID)
+		},
+		"ForcePasswordReset": func(u *adminUsecase, actorID, userID string) error {
+			return u.ForcePasswordReset(actorID, userID)
+		},
+	}
+
+	tests := []struct {
+		actor, target string
+		allowed       bool
+	}{
+		{"support", "user", true},
+		{"support", "legacy", true},
+		{"support", "admin", false},
+		{"user", "support", false},
+		{"admin", "support", true},
+		{"admin", "admin2", true},
+	}
+
+	for name, action := range actions {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.actor+"->"+tt.target, func(t *testing.T) {
+				u, security := newTestUsecase()
+
+				err := action(u, tt.actor, tt.target)
+				if tt.allowed {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if len(security.calls) == 0 {
+						t.Error("action was not carried out")
+					}
+					return
+				}
+
+				if !errors.Is(err, domain.ErrOutranked) {
+					t.Fatalf("err = %v, want ErrOutranked", err)
+				}
+				if len(security.calls) != 0 {
+					t.Errorf("refused action still called %v", security.calls)
+				}
+				if events := u.auditRepo.(*fakeAuditRepo).events; len(events) != 0 {
+					t.Errorf("refused action was audited: %v", events)
+				}
+			})
+		}
+	}
+}
+
+func TestReinstateUserRespectsRoles(t *testing.T) {
+	u, _ := newTestUsecase()
+	users := u.userRepo.(*fakeUserRepo).users
+	users["admin"].Status = userDomain.StatusSuspended
+
+	if err := u.ReinstateUser("support", "admin"); !errors.Is(err, domain.ErrOutranked) {
+		t.Fatalf("err = %v, want ErrOutranked", err)
+	}
+	if users["admin"].Status != userDomain.StatusSuspended {
+		t.Error("admin was reinstated by support")
+	}
+
+	if err := u.ReinstateUser("admin2", "admin"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAdminActionsUnknownUsers(t *testing.T) {
+	u, _ := newTestUsecase()
+
+	if err := u.SuspendUser("admin", "missing", "test"); err == nil || errors.Is(err, domain.ErrOutranked) {
+		t.Errorf("suspending a missing user: err = %v", err)
+	}
+
+	// An actor that cannot be loaded holds no roles
+	if err := u.ForcePasswordReset("missing", "user"); !errors.Is(err, domain.ErrOutranked) {
+		t.Errorf("unknown actor: err = %v, want ErrOutranked", err)
+	}
+}
+
+func TestHardDeleteUserPurges(t *testing.T) {
+	u, _ := newTestUsecase()
+	purger := u.purger.(*fakePurger)
+
+	if err := u.HardDeleteUser("admin", "user"); err == nil {
+		t.Error("purged a user that was not deleted")
+	}
+
+	if err := u.HardDeleteUser("admin", "deleted"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(purger.purged) != 1 || purger.purged[0] != "deleted" {
+		t.Errorf("purged %v, want [deleted]", purger.purged)
+	}
+}
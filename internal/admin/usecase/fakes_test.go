@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"errors"
+
+	"github.com/nightnice1st/testGridWhiz/internal/admin/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/rbac"
+	userDomain "github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// fakeUserRepo serves users from memory.
+type fakeUserRepo struct {
+	userDomain.UserRepository
+	users map[string]*userDomain.User
+}
+
+func (r *fakeUserRepo) FindByID(id string) (*userDomain.User, error) {
+	user, ok := r.users[id]
+	if !ok || user.Status == userDomain.StatusDeleted {
+		return nil, errors.New("not found")
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) FindDeletedByID(id string) (*userDomain.User, error) {
+	user, ok := r.users[id]
+	if !ok || user.Status != userDomain.StatusDeleted {
+		return nil, errors.New("not found")
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) SetStatus(id string, change userDomain.StatusChange) error {
+	r.users[id].Status = change.To
+	return nil
+}
+
+type fakeAuditRepo struct {
+	domain.AuditRepository
+	events []*domain.AuditEvent
+}
+
+func (r *fakeAuditRepo) Record(event *domain.AuditEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+type fakeSecurity struct {
+	calls []string
+}
+
+func (s *fakeSecurity) LogoutAll(userID string) error {
+	s.calls = append(s.calls, "logout_all:"+userID)
+	return nil
+}
+
+func (s *fakeSecurity) ForcePasswordReset(userID string) error {
+	s.calls = append(s.calls, "force_password_reset:"+userID)
+	return nil
+}
+
+func (s *fakeSecurity) UnlockAccount(actorID, userID string) error {
+	s.calls = append(s.calls, "unlock:"+userID)
+	return nil
+}
+
+type fakePurger struct {
+	userDomain.AccountPurger
+	purged []string
+}
+
+func (p *fakePurger) Purge(user *userDomain.User) error {
+	p.purged = append(p.purged, user.ID)
+	return nil
+}
+
+// newTestUsecase returns a usecase with a user of every role, one without
+// roles and a deleted one.
+func newTestUsecase() (*adminUsecase, *fakeSecurity) {
+	users := map[string]*userDomain.User{
+		"admin":   {ID: "admin", Roles: []string{rbac.RoleAdmin}, Status: userDomain.StatusActive},
+		"admin2":  {ID: "admin2", Roles: []string{rbac.RoleAdmin}, Status: userDomain.StatusActive},
+		"support": {ID: "support", Roles: []string{rbac.RoleSupport}, Status: userDomain.StatusActive},
+		"user":    {ID: "user", Roles: []string{rbac.RoleUser}, Status: userDomain.StatusActive},
+		"legacy":  {ID: "legacy", Status: userDomain.StatusActive},
+		"deleted": {ID: "deleted", Roles: []string{rbac.RoleUser}, Status: userDomain.StatusDeleted},
+	}
+
+	security := &fakeSecurity{}
+	u := &adminUsecase{
+		userRepo:  &fakeUserRepo{users: users},
+		auditRepo: &fakeAuditRepo{},
+		security:  security,
+		purger:    &fakePurger{},
+	}
+	return u, security
+}
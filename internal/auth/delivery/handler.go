@@ -2,11 +2,17 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"net"
 
+	"github.com/nightnice1st/testGridWhiz/internal/auth/domain"
 	"github.com/nightnice1st/testGridWhiz/internal/auth/usecase"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
 	pb "github.com/nightnice1st/testGridWhiz/pb"
 
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -38,23 +44,65 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 }
 
 func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	token, err := h.authUsecase.Login(req.Email, req.Password)
+	proof := domain.ChallengeProof{
+		Challenge: req.Challenge,
+		Nonce:     req.ChallengeNonce,
+	}
+
+	result, err := h.authUsecase.Login(req.Email, req.Password, clientInfo(ctx), proof)
+	if errors.Is(err, domain.ErrChallengeRequired) || errors.Is(err, domain.ErrInvalidChallenge) {
+		return &pb.LoginResponse{
+			Success:           false,
+			Message:           err.Error(),
+			ChallengeRequired: true,
+		}, status.Error(codes.FailedPrecondition, err.Error())
+	}
 	if err != nil {
 		return &pb.LoginResponse{
 			Success: false,
 			Message: err.Error(),
-		}, status.Error(codes.Unauthenticated, err.Error())
+		}, errorStatus(codes.Unauthenticated, err)
+	}
+
+	if result.MFAToken != "" {
+		return &pb.LoginResponse{
+			Success:     true,
+			Message:     "MFA verification required",
+			MfaRequired: true,
+			MfaToken:    result.MFAToken,
+		}, nil
 	}
 
+	tokens := result.Tokens
 	return &pb.LoginResponse{
-		Success: true,
-		Message: "Login successful",
-		Token:   token,
+		Success:      true,
+		Message:      "Login successful",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+func (h *AuthHandler) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	tokens, err := h.authUsecase.RefreshToken(req.RefreshToken)
+	if err != nil {
+		return &pb.RefreshTokenResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return &pb.RefreshTokenResponse{
+		Success:      true,
+		Message:      "Token refreshed successfully",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
 	}, nil
 }
 
 func (h *AuthHandler) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
-	err := h.authUsecase.Logout(req.Token)
+	err := h.authUsecase.Logout(req.Token, req.RefreshToken)
 	if err != nil {
 		return &pb.LogoutResponse{
 			Success: false,
@@ -67,3 +115,333 @@ func (h *AuthHandler) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.Lo
 		Message: "Logout successful",
 	}, nil
 }
+
+func (h *AuthHandler) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	set := h.authUsecase.JWKS()
+
+	keys := make([]*pb.JSONWebKey, len(set.Keys))
+	for i, key := range set.Keys {
+		keys[i] = &pb.JSONWebKey{
+			Kty: key.KeyType,
+			Kid: key.KeyID,
+			Use: key.Use,
+			Alg: key.Algorithm,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Curve,
+			X:   key.X,
+			Y:   key.Y,
+		}
+	}
+
+	return &pb.GetJWKSResponse{
+		Keys: keys,
+	}, nil
+}
+
+func (h *AuthHandler) EnrollMFA(ctx context.Context, req *pb.EnrollMFARequest) (*pb.EnrollMFAResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	secret, uri, err := h.authUsecase.EnrollMFA(userID)
+	if err != nil {
+		return &pb.EnrollMFAResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return &pb.EnrollMFAResponse{
+		Success:    true,
+		Message:    "Scan the URI with an authenticator app and confirm a code",
+		Secret:     secret,
+		OtpauthUri: uri,
+	}, nil
+}
+
+func (h *AuthHandler) ConfirmMFA(ctx context.Context, req *pb.ConfirmMFARequest) (*pb.ConfirmMFAResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	recoveryCodes, err := h.authUsecase.ConfirmMFA(userID, req.Code, clientInfo(ctx))
+	if err != nil {
+		return &pb.ConfirmMFAResponse{
+			Success: false,
+			Message: err.Error(),
+		}, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.ConfirmMFAResponse{
+		Success:       true,
+		Message:       "MFA enabled successfully",
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+func (h *AuthHandler) DisableMFA(ctx context.Context, req *pb.DisableMFARequest) (*pb.DisableMFAResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.authUsecase.DisableMFA(userID, req.Code, clientInfo(ctx))
+	if err != nil {
+		return &pb.DisableMFAResponse{
+			Success: false,
+			Message: err.Error(),
+		}, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.DisableMFAResponse{
+		Success: true,
+		Message: "MFA disabled successfully",
+	}, nil
+}
+
+func (h *AuthHandler) VerifyMFA(ctx context.Context, req *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, error) {
+	tokens, err := h.authUsecase.VerifyMFA(req.MfaToken, req.Code, clientInfo(ctx))
+	if err != nil {
+		return &pb.VerifyMFAResponse{
+			Success: false,
+			Message: err.Error(),
+		}, errorStatus(codes.Unauthenticated, err)
+	}
+
+	return &pb.VerifyMFAResponse{
+		Success:      true,
+		Message:      "Login successful",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+func (h *AuthHandler) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	err := h.authUsecase.RequestPasswordReset(req.Email)
+	if err != nil {
+		return &pb.RequestPasswordResetResponse{
+			Success: false,
+			Message: err.Error(),
+		}, errorStatus(codes.ResourceExhausted, err)
+	}
+
+	return &pb.RequestPasswordResetResponse{
+		Success: true,
+		Message: "If the account exists, a password reset token has been sent",
+	}, nil
+}
+
+func (h *AuthHandler) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	err := h.authUsecase.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		return &pb.ResetPasswordResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.ResetPasswordResponse{
+		Success: true,
+		Message: "Password reset successfully",
+	}, nil
+}
+
+func (h *AuthHandler) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	err := h.authUsecase.VerifyEmail(req.Token)
+	if err != nil {
+		return &pb.VerifyEmailResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.VerifyEmailResponse{
+		Success: true,
+		Message: "Email address verified successfully",
+	}, nil
+}
+
+func (h *AuthHandler) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	err := h.authUsecase.ResendVerification(req.Email)
+	if err != nil {
+		return &pb.ResendVerificationResponse{
+			Success: false,
+			Message: err.Error(),
+		}, errorStatus(codes.ResourceExhausted, err)
+	}
+
+	return &pb.ResendVerificationResponse{
+		Success: true,
+		Message: "If the account needs verification, a new token has been sent",
+	}, nil
+}
+
+func (h *AuthHandler) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	sessionID, _ := ctx.Value("sessionID").(string)
+
+	tokens, err := h.authUsecase.ChangePassword(userID, sessionID, req.CurrentPassword, req.NewPassword, req.KeepCurrentSession)
+	if err != nil {
+		return &pb.ChangePasswordResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := &pb.ChangePasswordResponse{
+		Success: true,
+		Message: "Password changed successfully",
+	}
+	if tokens != nil {
+		resp.Token = tokens.AccessToken
+		resp.RefreshToken = tokens.RefreshToken
+		resp.ExpiresIn = int64(tokens.ExpiresIn.Seconds())
+	}
+
+	return resp, nil
+}
+
+func (h *AuthHandler) LogoutAll(ctx context.Context, req *pb.LogoutAllRequest) (*pb.LogoutAllResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.authUsecase.LogoutAll(userID)
+	if err != nil {
+		return &pb.LogoutAllResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.LogoutAllResponse{
+		Success: true,
+		Message: "Logged out of all sessions",
+	}, nil
+}
+
+func (h *AuthHandler) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	sessionID, _ := ctx.Value("sessionID").(string)
+
+	sessions, err := h.authUsecase.ListSessions(userID)
+	if err != nil {
+		return &pb.ListSessionsResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.Internal, err.Error())
+	}
+
+	pbSessions := make([]*pb.Session, len(sessions))
+	for i, session := range sessions {
+		pbSessions[i] = &pb.Session{
+			Id:         session.ID,
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			LastSeenAt: session.LastSeenAt.Format("2006-01-02T15:04:05Z"),
+			Current:    session.ID == sessionID,
+		}
+	}
+
+	return &pb.ListSessionsResponse{
+		Success:  true,
+		Message:  "Sessions retrieved successfully",
+		Sessions: pbSessions,
+	}, nil
+}
+
+func (h *AuthHandler) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	err := h.authUsecase.RevokeSession(userID, req.SessionId)
+	if err != nil {
+		return &pb.RevokeSessionResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.RevokeSessionResponse{
+		Success: true,
+		Message: "Session revoked successfully",
+	}, nil
+}
+
+func (h *AuthHandler) RestoreAccount(ctx context.Context, req *pb.RestoreAccountRequest) (*pb.RestoreAccountResponse, error) {
+	err := h.authUsecase.RestoreAccount(req.Email, req.Password, req.MfaCode)
+	if err != nil {
+		return &pb.RestoreAccountResponse{
+			Success: false,
+			Message: err.Error(),
+		}, errorStatus(codes.Unauthenticated, err)
+	}
+
+	return &pb.RestoreAccountResponse{
+		Success: true,
+		Message: "Account restored successfully, you can log in again",
+	}, nil
+}
+
+func (h *AuthHandler) GetLoginChallenge(ctx context.Context, req *pb.GetLoginChallengeRequest) (*pb.GetLoginChallengeResponse, error) {
+	token, challenge, err := h.authUsecase.IssueLoginChallenge(req.Email, clientInfo(ctx))
+	if err != nil {
+		return &pb.GetLoginChallengeResponse{
+			Success: false,
+			Message: err.Error(),
+		}, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.GetLoginChallengeResponse{
+		Success:    true,
+		Message:    "Solve the challenge and send the nonce with the next login",
+		Challenge:  token,
+		Difficulty: int32(challenge.Difficulty),
+		ExpiresAt:  challenge.ExpiresAt.Format("2006-01-02T15:04:05Z"),
+	}, nil
+}
+
+// errorStatus converts err to a status with code. Rate limit errors carry
+// their own status, with a retry delay.
+func errorStatus(code codes.Code, err error) error {
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.GRPCStatus().Err()
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// clientInfo describes the device a request came from.
+func clientInfo(ctx context.Context) domain.ClientInfo {
+	var client domain.ClientInfo
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgent := md.Get("user-agent"); len(userAgent) > 0 {
+			client.UserAgent = userAgent[0]
+		}
+	}
+
+	return client
+}
@@ -2,9 +2,13 @@ package grpc
 
 import (
 	"context"
+	"log"
 	"strings"
 
 	"github.com/nightnice1st/testGridWhiz/internal/auth/usecase"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/jwt"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/rbac"
+	pb "github.com/nightnice1st/testGridWhiz/pb"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -12,42 +16,188 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Methods that can be called without an access token
+var publicMethods = map[string]bool{
+	pb.AuthService_Register_FullMethodName:     true,
+	pb.AuthService_Login_FullMethodName:        true,
+	pb.AuthService_Logout_FullMethodName:       true,
+	pb.AuthService_RefreshToken_FullMethodName: true,
+	pb.AuthService_GetJWKS_FullMethodName:      true,
+	pb.AuthService_VerifyMFA_FullMethodName:    true,
+
+	pb.AuthService_RequestPasswordReset_FullMethodName: true,
+	pb.AuthService_ResetPassword_FullMethodName:        true,
+	pb.AuthService_VerifyEmail_FullMethodName:          true,
+	pb.AuthService_ResendVerification_FullMethodName:   true,
+	pb.AuthService_RestoreAccount_FullMethodName:       true,
+	pb.AuthService_GetLoginChallenge_FullMethodName:    true,
+}
+
+// Methods that accept tokens of users whose email address is not verified
+var unverifiedMethods = map[string]bool{
+	pb.UserService_GetProfile_FullMethodName: true,
+}
+
+// methodPermission is the permission a method needs. Methods that act on a
+// user named by the request's user_id can be called on one's own account,
+// or when user_id is empty, without it.
+type methodPermission struct {
+	permission rbac.Permission
+	allowSelf  bool
+}
+
+// Permissions required by each method. Authenticated methods that are not
+// listed are open to every user.
+var methodPermissions = map[string]methodPermission{
+	pb.UserService_ListUsers_FullMethodName:     {permission: rbac.PermUsersList},
+	pb.UserService_GetProfile_FullMethodName:    {permission: rbac.PermUsersRead, allowSelf: true},
+	pb.UserService_UpdateProfile_FullMethodName: {permission: rbac.PermUsersUpdate, allowSelf: true},
+	pb.UserService_DeleteProfile_FullMethodName: {permission: rbac.PermUsersDelete, allowSelf: true},
+
+	pb.AdminService_SuspendUser_FullMethodName:        {permission: rbac.PermUsersSuspend},
+	pb.AdminService_ReinstateUser_FullMethodName:      {permission: rbac.PermUsersSuspend},
+	pb.AdminService_UnlockUser_FullMethodName:         {permission: rbac.PermUsersUnlock},
+	pb.AdminService_ForcePasswordReset_FullMethodName: {permission: rbac.PermUsersResetPassword},
+	pb.AdminService_AssignRoles_FullMethodName:        {permission: rbac.PermRolesAssign},
+	pb.AdminService_ListDeletedUsers_FullMethodName:   {permission: rbac.PermUsersPurge},
+	pb.AdminService_HardDeleteUser_FullMethodName:     {permission: rbac.PermUsersPurge},
+	pb.AdminService_ListAuditEvents_FullMethodName:    {permission: rbac.PermAuditRead},
+
+	pb.AdminService_ListAttributeDefinitions_FullMethodName:  {permission: rbac.PermAttributesManage},
+	pb.AdminService_SetAttributeDefinition_FullMethodName:    {permission: rbac.PermAttributesManage},
+	pb.AdminService_DeleteAttributeDefinition_FullMethodName: {permission: rbac.PermAttributesManage},
+}
+
 func AuthInterceptor(authUsecase *usecase.AuthUsecase) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		// Skip auth for auth service methods
-		if strings.Contains(info.FullMethod, "AuthService") {
-			return handler(ctx, req)
+		ctx, err := authenticate(ctx, authUsecase, info.FullMethod)
+		if err != nil {
+			return nil, err
 		}
 
-		// Extract token from metadata
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
-		}
+		return handler(ctx, req)
+	}
+}
 
-		authHeader := md.Get("authorization")
-		if len(authHeader) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing authorization header")
+// AuthStreamInterceptor is AuthInterceptor for streaming methods.
+func AuthStreamInterceptor(authUsecase *usecase.AuthUsecase) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authUsecase, info.FullMethod)
+		if err != nil {
+			return err
 		}
 
-		// Extract token from "Bearer <token>"
-		tokenParts := strings.Split(authHeader[0], " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			return nil, status.Error(codes.Unauthenticated, "invalid authorization header format")
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// AuthorizationInterceptor enforces methodPermissions. It must run after
+// AuthInterceptor.
+func AuthorizationInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorize(ctx, info.FullMethod, req); err != nil {
+			return nil, err
 		}
 
-		token := tokenParts[1]
+		return handler(ctx, req)
+	}
+}
 
-		// Validate token
-		claims, err := authUsecase.ValidateToken(token)
-		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, err.Error())
+// AuthorizationStreamInterceptor is AuthorizationInterceptor for streaming
+// methods. The request is not known yet, so allowSelf never applies.
+func AuthorizationStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), info.FullMethod, nil); err != nil {
+			return err
 		}
 
-		// Add user info to context
-		ctx = context.WithValue(ctx, "userID", claims.UserID)
-		ctx = context.WithValue(ctx, "email", claims.Email)
+		return handler(srv, ss)
+	}
+}
 
-		return handler(ctx, req)
+// authenticate validates the bearer token of a call to method and returns
+// the context carrying the caller.
+func authenticate(ctx context.Context, authUsecase *usecase.AuthUsecase, method string) (context.Context, error) {
+	// Skip auth for public methods
+	if publicMethods[method] {
+		return ctx, nil
 	}
+
+	// Extract token from metadata
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing metadata")
+	}
+
+	authHeader := md.Get("authorization")
+	if len(authHeader) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization header")
+	}
+
+	// Extract token from "Bearer <token>"
+	tokenParts := strings.Split(authHeader[0], " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization header format")
+	}
+
+	token := tokenParts[1]
+
+	// Validate token
+	claims, err := authUsecase.ValidateToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	// Tokens of unverified users only reach a few methods
+	if claims.Scope == jwt.ScopeUnverified && !unverifiedMethods[method] {
+		return nil, status.Error(codes.PermissionDenied, "email address has not been verified")
+	}
+
+	// Keep the last seen time of the session current
+	if err := authUsecase.TouchSession(claims.SessionID); err != nil {
+		log.Printf("Failed to update session %s: %v", claims.SessionID, err)
+	}
+
+	// Add user info to context
+	ctx = context.WithValue(ctx, "userID", claims.UserID)
+	ctx = context.WithValue(ctx, "email", claims.Email)
+	ctx = context.WithValue(ctx, "sessionID", claims.SessionID)
+	ctx = context.WithValue(ctx, "roles", claims.Roles)
+
+	return ctx, nil
+}
+
+func authorize(ctx context.Context, method string, req interface{}) error {
+	required, ok := methodPermissions[method]
+	if !ok {
+		return nil
+	}
+
+	userID, _ := ctx.Value("userID").(string)
+	roles, _ := ctx.Value("roles").([]string)
+
+	// Callers acting on their own account need no permission
+	if required.allowSelf {
+		if target, ok := req.(interface{ GetUserId() string }); ok {
+			if id := target.GetUserId(); id == "" || id == userID {
+				return nil
+			}
+		}
+	}
+
+	if !rbac.HasPermission(roles, required.permission) {
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return nil
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
 }
@@ -1,19 +1,177 @@
 package domain
 
 import (
+	"errors"
 	"time"
 )
 
+// TokenRevoke records an access token that was explicitly revoked. The
+// token itself is not stored, only its jti and session.
 type TokenRevoke struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	JTI       string    `bson:"jti" json:"jti"`
+	SessionID string    `bson:"session_id" json:"session_id"`
+	UserID    string    `bson:"user_id" json:"user_id"`
+	RevokedAt time.Time `bson:"revoked_at" json:"revoked_at"`
+}
+
+// LoginAttempt tracks the failed logins to an email address. Attempts
+// counts the failures since the last lockout, Lockouts the lockouts since
+// the last successful login.
+type LoginAttempt struct {
+	Email        string    `bson:"email" json:"email"`
+	Attempts     int       `bson:"attempts" json:"attempts"`
+	LastTry      time.Time `bson:"last_try" json:"last_try"`
+	BlockedAt    time.Time `bson:"blocked_at,omitempty" json:"blocked_at,omitzero"`
+	BlockedUntil time.Time `bson:"blocked_until,omitempty" json:"blocked_until,omitzero"`
+	Lockouts     int       `bson:"lockouts,omitempty" json:"lockouts,omitempty"`
+}
+
+// LoginAttemptRepository keeps the failed logins of every email address.
+type LoginAttemptRepository interface {
+	GetLoginAttempts(email string) (*LoginAttempt, error)
+	RecordFailedLogin(email string, window time.Duration) (*LoginAttempt, error)
+	BlockLogin(email string, threshold int, until time.Time) (*LoginAttempt, error)
+	ResetLoginAttempts(email string) error
+}
+
+// LockoutPolicy locks an email address out for Duration after Threshold
+// failed logins, each within Window of the one before. Each further lockout
+// doubles the duration, up to MaxDuration. Only with LockAccount set does a
+// lockout beyond MaxDuration lock the account until an operator unlocks it,
+// as anyone knowing the address could trigger it. A zero Threshold disables
+// lockouts, a zero Window never forgets failures and a zero MaxDuration
+// keeps every lockout at Duration.
+type LockoutPolicy struct {
+	Threshold   int
+	Window      time.Duration
+	Duration    time.Duration
+	MaxDuration time.Duration
+	LockAccount bool
+}
+
+// LockoutDuration returns how long the lockout following lockouts earlier
+// ones lasts, at most MaxDuration, and whether it was capped.
+func (p LockoutPolicy) LockoutDuration(lockouts int) (time.Duration, bool) {
+	if p.MaxDuration <= 0 {
+		return p.Duration, false
+	}
+
+	duration := p.Duration
+	for i := 0; i < lockouts; i++ {
+		duration *= 2
+		if duration > p.MaxDuration {
+			return p.MaxDuration, true
+		}
+	}
+
+	return duration, duration > p.MaxDuration
+}
+
+// ChallengePolicy demands a proof of work before the credentials of a login
+// are checked, once there were too many failed logins within Window to the
+// account, from the client's IP address or from its subnet. A zero number of
+// failures disables that counter. Challenges need Difficulty leading zero
+// bits and expire after Expiry.
+type ChallengePolicy struct {
+	AccountFailures int
+	IPFailures      int
+	SubnetFailures  int
+	Window          time.Duration
+	Difficulty      int
+	Expiry          time.Duration
+}
+
+// LoginChallenge is a proof of work issued to a client. It is answered once,
+// for the email address and from the IP address it was issued for. Only the
+// hash of the challenge is stored.
+type LoginChallenge struct {
+	ID         string    `bson:"_id,omitempty"`
+	TokenHash  string    `bson:"token_hash"`
+	Email      string    `bson:"email"`
+	IP         string    `bson:"ip"`
+	Difficulty int       `bson:"difficulty"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+	UsedAt     time.Time `bson:"used_at,omitempty"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+// ChallengeProof answers a login challenge with a nonce solving it.
+type ChallengeProof struct {
+	Challenge string
+	Nonce     string
+}
+
+var ErrChallengeRequired = errors.New("too many failed logins, solve a login challenge first")
+
+var ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+
+var ErrInvalidMFACode = errors.New("invalid MFA code")
+
+var ErrMFACodeUsed = errors.New("MFA code has already been used")
+
+// RefreshToken is a single-use credential that can be exchanged for a new
+// access token. Every rotation creates a new token in the same family, so
+// reuse of an already rotated token can revoke the whole chain.
+type RefreshToken struct {
 	ID        string    `bson:"_id,omitempty"`
-	Token     string    `bson:"token"`
+	TokenHash string    `bson:"token_hash"`
 	UserID    string    `bson:"user_id"`
-	RevokedAt time.Time `bson:"revoked_at"`
+	FamilyID  string    `bson:"family_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	UsedAt    time.Time `bson:"used_at,omitempty"`
+	RevokedAt time.Time `bson:"revoked_at,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
 }
 
-type LoginAttempt struct {
-	Email     string    `bson:"email"`
-	Attempts  int       `bson:"attempts"`
-	LastTry   time.Time `bson:"last_try"`
-	BlockedAt time.Time `bson:"blocked_at,omitempty"`
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// LoginResult holds either the issued tokens or, when the account has MFA
+// enabled, a challenge token to exchange through VerifyMFA.
+type LoginResult struct {
+	Tokens   *TokenPair
+	MFAToken string
+}
+
+// OneTimeToken is a hashed, single-use, expiring token delivered to the user
+// out of band, such as a password reset token.
+type OneTimeToken struct {
+	ID        string    `bson:"_id,omitempty"`
+	TokenHash string    `bson:"token_hash"`
+	UserID    string    `bson:"user_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	UsedAt    time.Time `bson:"used_at,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// Policies for logging in before the email address is verified
+const (
+	UnverifiedLoginAllow   = "allow"
+	UnverifiedLoginLimited = "limited"
+	UnverifiedLoginDeny    = "deny"
+)
+
+// Session is a single login of a user on a device. Its ID is also the
+// refresh token family and the sid claim of every access token issued in
+// it, so revoking the session rejects all of them.
+type Session struct {
+	ID         string    `bson:"_id" json:"id"`
+	UserID     string    `bson:"user_id" json:"user_id"`
+	JTI        string    `bson:"jti" json:"jti"`
+	UserAgent  string    `bson:"user_agent" json:"user_agent"`
+	IP         string    `bson:"ip" json:"ip"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	LastSeenAt time.Time `bson:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+	RevokedAt  time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitzero"`
+}
+
+// ClientInfo describes the client a request came from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
 }
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     LockoutPolicy
+		lockouts   int
+		want       time.Duration
+		wantCapped bool
+	}{
+		{"first lockout", LockoutPolicy{Duration: time.Minute, MaxDuration: time.Hour}, 0, time.Minute, false},
+		{"doubled", LockoutPolicy{Duration: time.Minute, MaxDuration: time.Hour}, 3, 8 * time.Minute, false},
+		{"at the longest", LockoutPolicy{Duration: time.Minute, MaxDuration: 4 * time.Minute}, 2, 4 * time.Minute, false},
+		{"capped", LockoutPolicy{Duration: time.Minute, MaxDuration: time.Hour}, 6, time.Hour, true},
+		{"capped after many lockouts", LockoutPolicy{Duration: time.Minute, MaxDuration: time.Hour}, 1000, time.Hour, true},
+		{"longest equals first", LockoutPolicy{Duration: time.Minute, MaxDuration: time.Minute}, 1, time.Minute, true},
+		// A zero longest lockout does not lock the account on the first one
+		{"no longest, first lockout", LockoutPolicy{Duration: time.Minute}, 0, time.Minute, false},
+		{"no longest, later lockout", LockoutPolicy{Duration: time.Minute}, 5, time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, capped := tt.policy.LockoutDuration(tt.lockouts)
+			if got != tt.want || capped != tt.wantCapped {
+				t.Errorf("LockoutDuration(%d) = %v, %v, want %v, %v", tt.lockouts, got, capped, tt.want, tt.wantCapped)
+			}
+		})
+	}
+}
@@ -15,22 +15,92 @@ type AuthRepository struct {
 	db          *mongo.Database
 	tokenColl   *mongo.Collection
 	attemptColl *mongo.Collection
+	refreshColl *mongo.Collection
+	resetColl   *mongo.Collection
+	verifyColl  *mongo.Collection
+	sessionColl *mongo.Collection
+
+	challengeColl *mongo.Collection
 }
 
 func NewAuthRepository(db *mongo.Database) *AuthRepository {
+	refreshColl := db.Collection("refreshTokens")
+	resetColl := db.Collection("passwordResets")
+	verifyColl := db.Collection("emailVerifications")
+	sessionColl := db.Collection("sessions")
+	attemptColl := db.Collection("loginAttempts")
+	challengeColl := db.Collection("loginChallenges")
+
+	// Create indexes for token lookups and expiry
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	refreshColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "family_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+
+	resetColl.Indexes().CreateMany(ctx, oneTimeTokenIndexes())
+	verifyColl.Indexes().CreateMany(ctx, oneTimeTokenIndexes())
+
+	sessionColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+
+	attemptColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	challengeColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+
 	return &AuthRepository{
 		db:          db,
 		tokenColl:   db.Collection("tokenRevoke"),
-		attemptColl: db.Collection("loginAttempts"),
+		attemptColl: attemptColl,
+		refreshColl: refreshColl,
+		resetColl:   resetColl,
+		verifyColl:  verifyColl,
+		sessionColl: sessionColl,
+
+		challengeColl: challengeColl,
 	}
 }
 
-func (r *AuthRepository) RevokeToken(token, userID string) error {
+func (r *AuthRepository) RevokeToken(jti, sessionID, userID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	revoke := &domain.TokenRevoke{
-		Token:     token,
+		JTI:       jti,
+		SessionID: sessionID,
 		UserID:    userID,
 		RevokedAt: time.Now(),
 	}
@@ -39,38 +109,103 @@ func (r *AuthRepository) RevokeToken(token, userID string) error {
 	return err
 }
 
-func (r *AuthRepository) IsTokenRevoked(token string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// DeleteUserData removes everything stored about a user that is being
+// permanently deleted.
+func (r *AuthRepository) DeleteUserData(userID, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var result domain.TokenRevoke
-	err := r.tokenColl.FindOne(ctx, bson.M{"token": token}).Decode(&result)
-
-	if err == mongo.ErrNoDocuments {
-		return false, nil
+	for _, coll := range []*mongo.Collection{r.tokenColl, r.refreshColl, r.sessionColl, r.resetColl, r.verifyColl} {
+		if _, err := coll.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+			return err
+		}
 	}
 
+	_, err := r.attemptColl.DeleteMany(ctx, bson.M{"email": email})
+	return err
+}
+
+func (r *AuthRepository) ListRevokedTokens(userID string) ([]*domain.TokenRevoke, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "revoked_at", Value: -1}})
+
+	cursor, err := r.tokenColl.Find(ctx, bson.M{"user_id": userID}, opts)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*domain.TokenRevoke
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
 	}
 
-	return true, nil
+	return tokens, nil
 }
 
-func (r *AuthRepository) RecordLoginAttempt(email string) error {
+// RecordFailedLogin counts a failed login to email and returns the updated
+// attempts. When the previous failure is older than window the count starts
+// over, a zero window keeps counting.
+func (r *AuthRepository) RecordFailedLogin(email string, window time.Duration) (*domain.LoginAttempt, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	now := time.Now()
+	attempts := bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$attempts", 0}}}, 1}}}
+	if window > 0 {
+		recent := bson.D{{Key: "$gt", Value: bson.A{"$last_try", now.Add(-window)}}}
+		attempts = bson.D{{Key: "$cond", Value: bson.A{recent, attempts, 1}}}
+	}
+
 	filter := bson.M{"email": email}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "attempts", Value: attempts},
+			{Key: "last_try", Value: now},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempt domain.LoginAttempt
+	if err := r.attemptColl.FindOneAndUpdate(ctx, filter, update, opts).Decode(&attempt); err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// BlockLogin locks email out until the given time if it has at least
+// threshold failed attempts, and starts counting attempts again. It returns
+// nil when a concurrent login already blocked it.
+func (r *AuthRepository) BlockLogin(email string, threshold int, until time.Time) (*domain.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"email": email, "attempts": bson.M{"$gte": threshold}}
 	update := bson.M{
-		"$inc": bson.M{"attempts": 1},
-		"$set": bson.M{"last_try": time.Now()},
+		"$set": bson.M{
+			"attempts":      0,
+			"blocked_at":    time.Now(),
+			"blocked_until": until,
+		},
+		"$inc": bson.M{"lockouts": 1},
 	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	_, err := r.attemptColl.UpdateOne(ctx, filter, update,
-		&options.UpdateOptions{Upsert: &[]bool{true}[0]})
+	var attempt domain.LoginAttempt
+	err := r.attemptColl.FindOneAndUpdate(ctx, filter, update, opts).Decode(&attempt)
 
-	return err
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
 }
 
 func (r *AuthRepository) GetLoginAttempts(email string) (*domain.LoginAttempt, error) {
@@ -94,3 +229,321 @@ func (r *AuthRepository) ResetLoginAttempts(email string) error {
 	_, err := r.attemptColl.DeleteOne(ctx, bson.M{"email": email})
 	return err
 }
+
+func (r *AuthRepository) CreateRefreshToken(token *domain.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token.CreatedAt = time.Now()
+
+	_, err := r.refreshColl.InsertOne(ctx, token)
+	return err
+}
+
+// UseRefreshToken atomically marks an unused, unrevoked refresh token as used
+// and returns it. It returns nil when no such token exists, which covers
+// unknown, rotated and revoked tokens alike.
+func (r *AuthRepository) UseRefreshToken(tokenHash string) (*domain.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    nil,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{"used_at": time.Now()},
+	}
+
+	var token domain.RefreshToken
+	err := r.refreshColl.FindOneAndUpdate(ctx, filter, update).Decode(&token)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *AuthRepository) FindRefreshToken(tokenHash string) (*domain.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var token domain.RefreshToken
+	err := r.refreshColl.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *AuthRepository) RevokeRefreshFamily(familyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"family_id": familyID, "revoked_at": nil}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := r.refreshColl.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// RevokeRefreshFamilyExcept revokes every refresh token of the family but
+// the one with keepTokenHash, so only the latest token of a session that
+// was reissued stays usable.
+func (r *AuthRepository) RevokeRefreshFamilyExcept(familyID, keepTokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"family_id":  familyID,
+		"token_hash": bson.M{"$ne": keepTokenHash},
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := r.refreshColl.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user except
+// those in exceptFamilyID, which may be empty.
+func (r *AuthRepository) RevokeUserRefreshTokens(userID, exceptFamilyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "revoked_at": nil}
+	if exceptFamilyID != "" {
+		filter["family_id"] = bson.M{"$ne": exceptFamilyID}
+	}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := r.refreshColl.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *AuthRepository) CreatePasswordReset(token *domain.OneTimeToken) error {
+	return createOneTimeToken(r.resetColl, token)
+}
+
+func (r *AuthRepository) UsePasswordReset(tokenHash string) (*domain.OneTimeToken, error) {
+	return useOneTimeToken(r.resetColl, tokenHash)
+}
+
+func (r *AuthRepository) InvalidatePasswordResets(userID string) error {
+	return invalidateOneTimeTokens(r.resetColl, userID)
+}
+
+func (r *AuthRepository) CreateEmailVerification(token *domain.OneTimeToken) error {
+	return createOneTimeToken(r.verifyColl, token)
+}
+
+func (r *AuthRepository) UseEmailVerification(tokenHash string) (*domain.OneTimeToken, error) {
+	return useOneTimeToken(r.verifyColl, tokenHash)
+}
+
+func (r *AuthRepository) InvalidateEmailVerifications(userID string) error {
+	return invalidateOneTimeTokens(r.verifyColl, userID)
+}
+
+func (r *AuthRepository) CreateLoginChallenge(challenge *domain.LoginChallenge) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	challenge.CreatedAt = time.Now()
+
+	_, err := r.challengeColl.InsertOne(ctx, challenge)
+	return err
+}
+
+// UseLoginChallenge atomically marks an unused, unexpired challenge as used
+// and returns it. It returns nil when no such challenge exists.
+func (r *AuthRepository) UseLoginChallenge(tokenHash string) (*domain.LoginChallenge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"used_at": now},
+	}
+
+	var challenge domain.LoginChallenge
+	err := r.challengeColl.FindOneAndUpdate(ctx, filter, update).Decode(&challenge)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+func (r *AuthRepository) CreateSession(session *domain.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+
+	_, err := r.sessionColl.InsertOne(ctx, session)
+	return err
+}
+
+func (r *AuthRepository) FindSession(id string) (*domain.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session domain.Session
+	err := r.sessionColl.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// ListUserSessions returns every stored session of the user, including
+// revoked ones, newest first.
+func (r *AuthRepository) ListUserSessions(userID string) ([]*domain.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.sessionColl.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*domain.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ListSessions returns the active sessions of the user, most recently used
+// first.
+func (r *AuthRepository) ListSessions(userID string) ([]*domain.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.sessionColl.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*domain.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// UpdateSessionToken records the latest access token issued in the session
+// and extends it to the lifetime of the new refresh token.
+func (r *AuthRepository) UpdateSessionToken(id, jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"jti":        jti,
+			"expires_at": expiresAt,
+		},
+	}
+
+	_, err := r.sessionColl.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// TouchSession updates the last seen time of the session. Writes are
+// throttled to one per interval.
+func (r *AuthRepository) TouchSession(id string, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":          id,
+		"last_seen_at": bson.M{"$lt": now.Add(-interval)},
+	}
+	update := bson.M{
+		"$set": bson.M{"last_seen_at": now},
+	}
+
+	_, err := r.sessionColl.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (r *AuthRepository) RevokeSession(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "revoked_at": nil}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := r.sessionColl.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RevokeUserSessions revokes every session of the user except exceptID,
+// which may be empty.
+func (r *AuthRepository) RevokeUserSessions(userID, exceptID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "revoked_at": nil}
+	if exceptID != "" {
+		filter["_id"] = bson.M{"$ne": exceptID}
+	}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := r.sessionColl.UpdateMany(ctx, filter, update)
+	return err
+}
@@ -0,0 +1,85 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// One-time tokens share the same document layout, each kind lives in its
+// own collection.
+
+func oneTimeTokenIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+}
+
+func createOneTimeToken(coll *mongo.Collection, token *domain.OneTimeToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token.CreatedAt = time.Now()
+
+	_, err := coll.InsertOne(ctx, token)
+	return err
+}
+
+// useOneTimeToken atomically marks an unused, unexpired token as used and
+// returns it. It returns nil when no such token exists.
+func useOneTimeToken(coll *mongo.Collection, tokenHash string) (*domain.OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"used_at": now},
+	}
+
+	var token domain.OneTimeToken
+	err := coll.FindOneAndUpdate(ctx, filter, update).Decode(&token)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// invalidateOneTimeTokens marks every outstanding token of the user as used.
+func invalidateOneTimeTokens(coll *mongo.Collection, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "used_at": nil}
+	update := bson.M{
+		"$set": bson.M{"used_at": time.Now()},
+	}
+
+	_, err := coll.UpdateMany(ctx, filter, update)
+	return err
+}
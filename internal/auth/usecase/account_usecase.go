@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RestoreAccount undoes the deletion of an account within the grace period.
+// Accounts with MFA enabled also need a TOTP or recovery code.
+func (u *AuthUsecase) RestoreAccount(email, password, mfaCode string) error {
+	// Check rate limit
+	if err := u.checkRateLimit("restore:"+email, "too many restore attempts, please try again later"); err != nil {
+		return err
+	}
+
+	user, err := u.findRestorable(email)
+	if err != nil {
+		return errors.New("invalid credentials")
+	}
+
+	// Compare password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return errors.New("invalid credentials")
+	}
+
+	if user.MFAEnabled {
+		if err := u.verifyMFACode(user, mfaCode); err != nil {
+			return err
+		}
+	}
+
+	return u.restoreAccount(user)
+}
+
+// PurgeUserData removes the tokens, sessions and login attempts of a user
+// whose account is permanently deleted.
+func (u *AuthUsecase) PurgeUserData(user *domain.User) error {
+	return u.authRepo.DeleteUserData(user.ID, user.Email)
+}
+
+// PersonalData returns the revoked tokens, login attempts and sessions of
+// the user.
+func (u *AuthUsecase) PersonalData(user *domain.User) (map[string]interface{}, error) {
+	tokens, err := u.authRepo.ListRevokedTokens(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := u.loginAttempts.GetLoginAttempts(user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := u.authRepo.ListUserSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"revoked_tokens": tokens,
+		"login_attempts": attempts,
+		"sessions":       sessions,
+	}, nil
+}
+
+// findRestorable returns the deleted account with the email address if its
+// grace period has not ended.
+func (u *AuthUsecase) findRestorable(email string) (*domain.User, error) {
+	user, err := u.userRepo.FindDeletedByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(user.DeletedAt) > u.deletionGrace {
+		return nil, errors.New("account can no longer be restored")
+	}
+
+	return user, nil
+}
+
+func (u *AuthUsecase) restoreAccount(user *domain.User) error {
+	change, err := domain.NewStatusChange(user, user.StatusBeforeDeletion(), "restored by the user", user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.SetStatus(user.ID, change); err != nil {
+		return err
+	}
+	user.DeletedAt = time.Time{}
+	user.Status = change.To
+
+	return u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your account was restored",
+		Body: fmt.Sprintf("Your account was restored on %s and will not be deleted. "+
+			"If this was not you, change your password immediately.", time.Now().Format(time.RFC1123)),
+	})
+}
@@ -2,11 +2,16 @@ package usecase
 
 import (
 	"errors"
+	"log"
 	"time"
 
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
 	mongo "github.com/nightnice1st/testGridWhiz/internal/auth/repository"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/jwt"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/rbac"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
 	"github.com/nightnice1st/testGridWhiz/internal/pkg/validator"
 	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
 
@@ -14,21 +19,61 @@ import (
 )
 
 type AuthUsecase struct {
-	userRepo    domain.UserRepository
-	authRepo    *mongo.AuthRepository
-	jwtSecret   string
-	jwtExpiry   time.Duration
-	rateLimiter *ratelimit.RateLimiter
+	userRepo        domain.UserRepository
+	authRepo        *mongo.AuthRepository
+	loginAttempts   authDomain.LoginAttemptRepository
+	keys            jwt.KeySet
+	jwtExpiry       time.Duration
+	refreshExpiry   time.Duration
+	rateLimiter     ratelimit.Limiter
+	mfaIssuer       string
+	notifier        notify.Notifier
+	resetExpiry     time.Duration
+	verifyExpiry    time.Duration
+	unverifiedLogin string
+	deletionGrace   time.Duration
+	lockout         authDomain.LockoutPolicy
+	challenge       authDomain.ChallengePolicy
+	loginFailures   *ratelimit.Counter
 }
 
-func NewAuthUsecase(userRepo domain.UserRepository, authRepo *mongo.AuthRepository,
-	jwtSecret string, jwtExpiry time.Duration, rateLimiter *ratelimit.RateLimiter) *AuthUsecase {
+// AuthDeps holds what the auth usecase is built from.
+type AuthDeps struct {
+	UserRepo        domain.UserRepository
+	AuthRepo        *mongo.AuthRepository
+	Keys            jwt.KeySet
+	JWTExpiry       time.Duration
+	RefreshExpiry   time.Duration
+	RateLimiter     ratelimit.Limiter
+	MFAIssuer       string
+	Notifier        notify.Notifier
+	ResetExpiry     time.Duration
+	VerifyExpiry    time.Duration
+	UnverifiedLogin string
+	DeletionGrace   time.Duration
+	Lockout         authDomain.LockoutPolicy
+	Challenge       authDomain.ChallengePolicy
+	LoginFailures   *ratelimit.Counter
+}
+
+func NewAuthUsecase(deps AuthDeps) *AuthUsecase {
 	return &AuthUsecase{
-		userRepo:    userRepo,
-		authRepo:    authRepo,
-		jwtSecret:   jwtSecret,
-		jwtExpiry:   jwtExpiry,
-		rateLimiter: rateLimiter,
+		userRepo:        deps.UserRepo,
+		authRepo:        deps.AuthRepo,
+		loginAttempts:   deps.AuthRepo,
+		keys:            deps.Keys,
+		jwtExpiry:       deps.JWTExpiry,
+		refreshExpiry:   deps.RefreshExpiry,
+		rateLimiter:     deps.RateLimiter,
+		mfaIssuer:       deps.MFAIssuer,
+		notifier:        deps.Notifier,
+		resetExpiry:     deps.ResetExpiry,
+		verifyExpiry:    deps.VerifyExpiry,
+		unverifiedLogin: deps.UnverifiedLogin,
+		deletionGrace:   deps.DeletionGrace,
+		lockout:         deps.Lockout,
+		challenge:       deps.Challenge,
+		loginFailures:   deps.LoginFailures,
 	}
 }
 
@@ -60,73 +105,359 @@ func (u *AuthUsecase) Register(email, password, name string) (*domain.User, erro
 		Email:    email,
 		Password: string(hashedPassword),
 		Name:     name,
+		Roles:    []string{rbac.RoleUser},
+
+		// Pending until the email address is verified
+		Status:          domain.StatusPending,
+		StatusChangedAt: time.Now(),
 	}
 
 	if err := u.userRepo.Create(user); err != nil {
 		return nil, err
 	}
 
+	// Send verification email, the user can ask for another one
+	if err := u.sendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
 	// Clear password before returning
 	user.Password = ""
 	return user, nil
 }
 
-func (u *AuthUsecase) Login(email, password string) (string, error) {
+// Login checks the credentials of a user. After repeated failed logins to
+// the account or from the client's network, proof has to answer a challenge
+// from IssueLoginChallenge first.
+func (u *AuthUsecase) Login(email, password string, client authDomain.ClientInfo, proof authDomain.ChallengeProof) (*authDomain.LoginResult, error) {
 	// Check rate limit
-	if !u.rateLimiter.Allow(email) {
-		return "", errors.New("too many login attempts, please try again later")
+	if err := u.checkRateLimit(email, "too many login attempts, please try again later"); err != nil {
+		return nil, err
 	}
 
-	// Record login attempt
-	if err := u.authRepo.RecordLoginAttempt(email); err != nil {
-		// Log error but don't fail login
+	// Repeated failures lock the address out, across restarts and replicas
+	if err := u.checkLockout(email); err != nil {
+		return nil, err
 	}
 
-	// Find user
+	// Credential stuffing from one network, or against one account, has to
+	// pay with a proof of work for every further attempt
+	if err := u.checkLoginChallenge(email, client, proof); err != nil {
+		return nil, err
+	}
+
+	// Find user, logging in to a deleted account within the grace period
+	// restores it
 	user, err := u.userRepo.FindByEmail(email)
+	restore := false
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		if user, err = u.findRestorable(email); err != nil {
+			u.recordFailedLogin(email, nil)
+			u.countLoginFailure(email, client)
+			return nil, errors.New("invalid credentials")
+		}
+		restore = true
 	}
 
 	// Compare password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+		u.recordFailedLogin(email, user)
+		u.countLoginFailure(email, client)
+		return nil, errors.New("invalid credentials")
 	}
 
-	// Generate JWT token
-	token, err := jwt.GenerateToken(user.ID, user.Email, u.jwtSecret, u.jwtExpiry)
+	if restore {
+		// The second factor is checked by RestoreAccount instead
+		if user.MFAEnabled {
+			return nil, errors.New("account is scheduled for deletion, restore it with RestoreAccount")
+		}
+
+		if err := u.restoreAccount(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		return nil, err
+	}
+
+	// Enforce the policy for unverified email addresses
+	if !user.EmailVerified && u.unverifiedLogin == authDomain.UnverifiedLoginDeny {
+		return nil, errors.New("email address has not been verified")
+	}
+
+	// Require the second factor before issuing any session
+	if user.MFAEnabled {
+		mfaToken, err := u.issueMFAChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &authDomain.LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	tokens, err := u.startSession(user, client)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Reset login attempts on successful login
-	u.authRepo.ResetLoginAttempts(email)
+	u.loginAttempts.ResetLoginAttempts(email)
+	u.resetLoginFailures(email)
+
+	return &authDomain.LoginResult{Tokens: tokens}, nil
+}
+
+func (u *AuthUsecase) RefreshToken(refreshToken string) (*authDomain.TokenPair, error) {
+	tokenHash := securetoken.Hash(refreshToken)
+
+	// Consume the refresh token so it can only be exchanged once
+	current, err := u.authRepo.UseRefreshToken(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		// A token that was already rotated is being replayed, so the chain
+		// has leaked. Revoke the whole session to lock out both parties.
+		existing, err := u.authRepo.FindRefreshToken(tokenHash)
+		if err != nil {
+			return nil, err
+		}
 
-	return token, nil
+		if existing != nil && !existing.UsedAt.IsZero() {
+			if err := u.revokeSession(existing.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("refresh token reuse detected")
+		}
+
+		return nil, errors.New("invalid refresh token")
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, errors.New("refresh token expired")
+	}
+
+	user, err := u.userRepo.FindByID(current.UserID)
+	if err != nil {
+		u.revokeSession(current.FamilyID)
+		return nil, errors.New("invalid refresh token")
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		return nil, err
+	}
+
+	return u.issueTokenPair(user, current.FamilyID)
 }
 
-func (u *AuthUsecase) Logout(token string) error {
+func (u *AuthUsecase) Logout(token, refreshToken string) error {
 	// Validate token first
-	claims, err := jwt.ValidateToken(token, u.jwtSecret)
+	claims, err := u.keys.Verify(token)
 	if err != nil {
 		return errors.New("invalid token")
 	}
 
 	// Revoke token
-	return u.authRepo.RevokeToken(token, claims.UserID)
+	if err := u.authRepo.RevokeToken(claims.ID, claims.SessionID, claims.UserID); err != nil {
+		return err
+	}
+
+	// End the session, and with it the refresh chain, the token belongs to
+	sessionID := claims.SessionID
+	if refreshToken != "" {
+		existing, err := u.authRepo.FindRefreshToken(securetoken.Hash(refreshToken))
+		if err != nil {
+			return err
+		}
+
+		if existing == nil || existing.UserID != claims.UserID {
+			return errors.New("invalid refresh token")
+		}
+		sessionID = existing.FamilyID
+	}
+
+	if sessionID == "" {
+		return nil
+	}
+
+	return u.revokeSession(sessionID)
 }
 
 func (u *AuthUsecase) ValidateToken(token string) (*jwt.Claims, error) {
-	// Check if token is revoked
-	isRevoked, err := u.authRepo.IsTokenRevoked(token)
+	// Validate token
+	claims, err := u.keys.Verify(token)
 	if err != nil {
 		return nil, err
 	}
 
-	if isRevoked {
+	// MFA challenge tokens cannot be used as access tokens
+	if claims.Scope == jwt.ScopeMFA {
+		return nil, errors.New("invalid token")
+	}
+
+	// Tokens issued before the user logged out everywhere are rejected
+	user, err := u.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if claims.IssuedAt == nil || claims.IssuedAt.Time.Before(user.TokensValidAfter) {
 		return nil, errors.New("token has been revoked")
 	}
 
-	// Validate token
-	return jwt.ValidateToken(token, u.jwtSecret)
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+
+	// Tokens die with the session they were issued in
+	session, err := u.authRepo.FindSession(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil || !session.RevokedAt.IsZero() {
+		return nil, errors.New("token has been revoked")
+	}
+
+	return claims, nil
+}
+
+// LogoutAll signs the user out of every session by rejecting all access
+// tokens issued so far and revoking every refresh token.
+func (u *AuthUsecase) LogoutAll(userID string) error {
+	return u.logoutAllExcept(userID, "")
+}
+
+// logoutAllExcept is LogoutAll but keeps the session keepSessionID, which
+// may be empty, alive.
+func (u *AuthUsecase) logoutAllExcept(userID, keepSessionID string) error {
+	// JWT iat has second precision, so tokens issued earlier within the
+	// current second stay valid
+	if err := u.userRepo.SetTokensValidAfter(userID, time.Now().Truncate(time.Second)); err != nil {
+		return err
+	}
+
+	if err := u.authRepo.RevokeUserSessions(userID, keepSessionID); err != nil {
+		return err
+	}
+
+	return u.authRepo.RevokeUserRefreshTokens(userID, keepSessionID)
+}
+
+// GrantAdmin gives the admin role to the existing accounts with the given
+// email addresses. Accounts that do not exist yet are skipped.
+func (u *AuthUsecase) GrantAdmin(emails []string) error {
+	for _, email := range emails {
+		user, err := u.userRepo.FindByEmail(email)
+		if err != nil {
+			log.Printf("Admin account %s not found, skipping", email)
+			continue
+		}
+
+		if rbac.HasRole(user.Roles, rbac.RoleAdmin) {
+			continue
+		}
+
+		if err := u.userRepo.SetRoles(user.ID, append(user.Roles, rbac.RoleAdmin)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkAccountStatus rejects accounts whose status does not allow signing
+// in. Pending accounts are subject to the unverified login policy instead.
+func checkAccountStatus(user *domain.User) error {
+	switch user.Status {
+	case domain.StatusSuspended:
+		return errors.New("account is suspended")
+	case domain.StatusLocked:
+		return errors.New("account is locked")
+	case domain.StatusDeleted:
+		return errors.New("account is deleted")
+	}
+
+	return nil
+}
+
+// checkAccountUsable rejects accounts that cannot sign in, or an operator
+// has locked until the password is reset.
+func checkAccountUsable(user *domain.User) error {
+	if err := checkAccountStatus(user); err != nil {
+		return err
+	}
+
+	if user.PasswordResetRequired {
+		return errors.New("password reset required, check your email for a reset token")
+	}
+
+	return nil
+}
+
+func (u *AuthUsecase) JWKS() *jwt.JSONWebKeySet {
+	return u.keys.JWKS()
+}
+
+// issueTokenPair issues an access token and the next refresh token of the
+// session, whose ID doubles as the refresh token family.
+func (u *AuthUsecase) issueTokenPair(user *domain.User, sessionID string) (*authDomain.TokenPair, error) {
+	// Generate JWT token, limited in scope until the email address is verified
+	claims := jwt.NewClaims(user.ID, user.Email, sessionID, u.jwtExpiry)
+	claims.Roles = user.Roles
+	if !user.EmailVerified && u.unverifiedLogin == authDomain.UnverifiedLoginLimited {
+		claims.Scope = jwt.ScopeUnverified
+	}
+
+	accessToken, err := u.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate the next refresh token in the family
+	refreshToken, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(u.refreshExpiry)
+	err = u.authRepo.CreateRefreshToken(&authDomain.RefreshToken{
+		TokenHash: securetoken.Hash(refreshToken),
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.authRepo.UpdateSessionToken(sessionID, claims.ID, expiresAt); err != nil {
+		return nil, err
+	}
+
+	return &authDomain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    u.jwtExpiry,
+	}, nil
+}
+
+// checkRateLimit counts an attempt against the rate limit of key, and
+// returns a LimitError with message once it is exceeded or the store could
+// not count the attempt for contention. When the limiter's store cannot be
+// reached the attempt is let through, the lockout policy still applies to
+// logins.
+func (u *AuthUsecase) checkRateLimit(key, message string) error {
+	result, err := u.rateLimiter.Allow(key)
+	if err != nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		return nil
+	}
+
+	if !result.Allowed {
+		return &ratelimit.LimitError{Message: message, RetryAfter: result.RetryAfter}
+	}
+
+	return nil
 }
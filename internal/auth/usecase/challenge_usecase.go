@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"log"
+	"net/netip"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/pow"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+)
+
+// IssueLoginChallenge returns a proof of work challenge for logging in to
+// email from the client. It is issued whether or not logins need one, so
+// the answer reveals nothing about the account.
+func (u *AuthUsecase) IssueLoginChallenge(email string, client authDomain.ClientInfo) (string, *authDomain.LoginChallenge, error) {
+	token, err := securetoken.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	challenge := &authDomain.LoginChallenge{
+		TokenHash:  securetoken.Hash(token),
+		Email:      email,
+		IP:         client.IP,
+		Difficulty: u.challenge.Difficulty,
+		ExpiresAt:  time.Now().Add(u.challenge.Expiry),
+	}
+
+	if err := u.authRepo.CreateLoginChallenge(challenge); err != nil {
+		return "", nil, err
+	}
+
+	return token, challenge, nil
+}
+
+// checkLoginChallenge demands an answered challenge from logins once there
+// were too many failures for one of their counters. Every challenge is
+// spent by its first answer, right or wrong.
+func (u *AuthUsecase) checkLoginChallenge(email string, client authDomain.ClientInfo, proof authDomain.ChallengeProof) error {
+	if !u.loginChallengeRequired(email, client) {
+		return nil
+	}
+
+	if proof.Challenge == "" {
+		return authDomain.ErrChallengeRequired
+	}
+
+	challenge, err := u.authRepo.UseLoginChallenge(securetoken.Hash(proof.Challenge))
+	if err != nil {
+		return err
+	}
+
+	return verifyLoginChallenge(challenge, email, client, proof)
+}
+
+// verifyLoginChallenge checks the answer to a challenge that was just spent,
+// nil when it was unknown, expired or spent before. A challenge only counts
+// for the email address and IP address it was issued to.
+func verifyLoginChallenge(challenge *authDomain.LoginChallenge, email string, client authDomain.ClientInfo, proof authDomain.ChallengeProof) error {
+	if challenge == nil || challenge.Email != email || challenge.IP != client.IP {
+		return authDomain.ErrInvalidChallenge
+	}
+
+	if !pow.Verify(proof.Challenge, proof.Nonce, challenge.Difficulty) {
+		return authDomain.ErrInvalidChallenge
+	}
+
+	return nil
+}
+
+// loginChallengeRequired reports whether a counter of the login reached its
+// threshold. A counter that cannot be read is logged and requires the
+// challenge, so an unreachable store does not turn the challenge off.
+func (u *AuthUsecase) loginChallengeRequired(email string, client authDomain.ClientInfo) bool {
+	for key, threshold := range u.failureCounters(email, client) {
+		count, err := u.loginFailures.Count(key)
+		if err != nil {
+			log.Printf("Failed to read failed logins of %s: %v", key, err)
+			return true
+		}
+
+		if count >= threshold {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countLoginFailure adds a failed login to each counter of the login.
+// Failures are logged, the login fails either way.
+func (u *AuthUsecase) countLoginFailure(email string, client authDomain.ClientInfo) {
+	for key := range u.failureCounters(email, client) {
+		if _, err := u.loginFailures.Add(key); err != nil {
+			log.Printf("Failed to count failed login of %s: %v", key, err)
+		}
+	}
+}
+
+// resetLoginFailures clears the failed logins of the account once its owner
+// logged in. The counters of the client's address and subnet are kept, an
+// attacker could clear them with an account of their own otherwise.
+func (u *AuthUsecase) resetLoginFailures(email string) {
+	if u.challenge.AccountFailures <= 0 {
+		return
+	}
+
+	if err := u.loginFailures.Reset("account:" + email); err != nil {
+		log.Printf("Failed to reset failed logins of %s: %v", email, err)
+	}
+}
+
+// failureCounters returns the enabled failed login counters of a login,
+// with their thresholds: one for the account, one for the client's IP
+// address and one for its /24 IPv4 or /64 IPv6 subnet.
+func (u *AuthUsecase) failureCounters(email string, client authDomain.ClientInfo) map[string]int {
+	counters := make(map[string]int)
+	if u.challenge.AccountFailures > 0 {
+		counters["account:"+email] = u.challenge.AccountFailures
+	}
+
+	addr, err := netip.ParseAddr(client.IP)
+	if err != nil {
+		return counters
+	}
+	addr = addr.Unmap()
+
+	if u.challenge.IPFailures > 0 {
+		counters["ip:"+addr.String()] = u.challenge.IPFailures
+	}
+
+	if u.challenge.SubnetFailures > 0 {
+		bits := 64
+		if addr.Is4() {
+			bits = 24
+		}
+
+		subnet, err := addr.Prefix(bits)
+		if err == nil {
+			counters["subnet:"+subnet.String()] = u.challenge.SubnetFailures
+		}
+	}
+
+	return counters
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/pow"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+)
+
+func TestVerifyLoginChallenge(t *testing.T) {
+	challenge := &authDomain.LoginChallenge{Email: "user@example.com", IP: "192.0.2.1", Difficulty: 12}
+	client := authDomain.ClientInfo{IP: "192.0.2.1"}
+	solved := authDomain.ChallengeProof{Challenge: "token", Nonce: pow.Solve("token", 12)}
+
+	tests := []struct {
+		name      string
+		challenge *authDomain.LoginChallenge
+		email     string
+		client    authDomain.ClientInfo
+		proof     authDomain.ChallengeProof
+		wantErr   bool
+	}{
+		{"solved", challenge, "user@example.com", client, solved, false},
+		// The repository returns nil for challenges spent before
+		{"spent or unknown", nil, "user@example.com", client, solved, true},
+		{"other email", challenge, "other@example.com", client, solved, true},
+		{"other IP", challenge, "user@example.com", authDomain.ClientInfo{IP: "192.0.2.2"}, solved, true},
+		{"wrong nonce", challenge, "user@example.com", client, authDomain.ChallengeProof{Challenge: "token", Nonce: "x"}, true},
+		{"answer to another challenge", challenge, "user@example.com", client,
+			authDomain.ChallengeProof{Challenge: "token", Nonce: pow.Solve("other", 12)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyLoginChallenge(tt.challenge, tt.email, tt.client, tt.proof)
+			if tt.wantErr && !errors.Is(err, authDomain.ErrInvalidChallenge) {
+				t.Errorf("err = %v, want ErrInvalidChallenge", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestResetLoginFailuresKeepsClientCounters(t *testing.T) {
+	u, _, _ := newTestUsecase(t)
+	u.challenge = authDomain.ChallengePolicy{AccountFailures: 2, IPFailures: 3}
+	attacker := authDomain.ClientInfo{IP: "192.0.2.1"}
+	owner := authDomain.ClientInfo{IP: "198.51.100.1"}
+
+	u.countLoginFailure("user@example.com", attacker)
+	u.countLoginFailure("user@example.com", attacker)
+	if !u.loginChallengeRequired("user@example.com", owner) {
+		t.Fatal("failed logins of the account did not require a challenge")
+	}
+
+	// The owner logs in, so the account needs no challenge anymore
+	u.resetLoginFailures("user@example.com")
+	if u.loginChallengeRequired("user@example.com", owner) {
+		t.Error("the account still needs a challenge after a successful login")
+	}
+
+	// The failures of the attacker's address still count
+	u.countLoginFailure("other@example.com", attacker)
+	if !u.loginChallengeRequired("other@example.com", attacker) {
+		t.Error("a successful login cleared the failures of the client's address")
+	}
+}
+
+func TestLoginChallengeRequiredWhenCountersCannotBeRead(t *testing.T) {
+	client := authDomain.ClientInfo{IP: "192.0.2.1"}
+
+	policies := []struct {
+		name   string
+		policy authDomain.ChallengePolicy
+	}{
+		{"account", authDomain.ChallengePolicy{AccountFailures: 3}},
+		{"IP", authDomain.ChallengePolicy{IPFailures: 3}},
+		{"subnet", authDomain.ChallengePolicy{SubnetFailures: 3}},
+	}
+
+	for _, tt := range policies {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _, _ := newTestUsecase(t)
+			u.challenge = tt.policy
+			u.loginFailures = ratelimit.NewCounter("login_failures", time.Hour, unreadableStore{})
+
+			if !u.loginChallengeRequired("user@example.com", client) {
+				t.Error("no challenge was required while the counter could not be read")
+			}
+		})
+	}
+
+	// Without counters there is nothing to read
+	u, _, _ := newTestUsecase(t)
+	u.challenge = authDomain.ChallengePolicy{}
+	u.loginFailures = ratelimit.NewCounter("login_failures", time.Hour, unreadableStore{})
+	if u.loginChallengeRequired("user@example.com", client) {
+		t.Error("a challenge was required with every counter disabled")
+	}
+}
@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/totp"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// fakeUserRepo keeps one user in memory, applying the MFA updates the way
+// the MongoDB repository does.
+type fakeUserRepo struct {
+	domain.UserRepository
+	user *domain.User
+}
+
+func (r *fakeUserRepo) FindByID(id string) (*domain.User, error) {
+	if r.user == nil || r.user.ID != id {
+		return nil, errors.New("not found")
+	}
+
+	copied := *r.user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) UpdateMFA(user *domain.User) error {
+	r.user.MFAEnabled = user.MFAEnabled
+	r.user.MFASecret = user.MFASecret
+	r.user.MFALastStep = user.MFALastStep
+	r.user.MFARecoveryCodes = user.MFARecoveryCodes
+	return nil
+}
+
+func (r *fakeUserRepo) UseMFAStep(id string, step int64) (bool, error) {
+	if r.user.MFALastStep >= step {
+		return false, nil
+	}
+
+	r.user.MFALastStep = step
+	return true, nil
+}
+
+func (r *fakeUserRepo) UseRecoveryCode(id, codeHash string) (bool, error) {
+	for i, hash := range r.user.MFARecoveryCodes {
+		if hash == codeHash {
+			r.user.MFARecoveryCodes = append(r.user.MFARecoveryCodes[:i], r.user.MFARecoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// fakeLoginAttempts keeps failed logins in memory, counting and blocking
+// them the way the MongoDB repository does.
+type fakeLoginAttempts struct {
+	attempts map[string]*authDomain.LoginAttempt
+}
+
+func (r *fakeLoginAttempts) GetLoginAttempts(email string) (*authDomain.LoginAttempt, error) {
+	attempt, ok := r.attempts[email]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (r *fakeLoginAttempts) RecordFailedLogin(email string, window time.Duration) (*authDomain.LoginAttempt, error) {
+	if r.attempts == nil {
+		r.attempts = make(map[string]*authDomain.LoginAttempt)
+	}
+
+	attempt, ok := r.attempts[email]
+	if !ok {
+		attempt = &authDomain.LoginAttempt{Email: email}
+		r.attempts[email] = attempt
+	}
+
+	now := time.Now()
+	if window > 0 && !attempt.LastTry.After(now.Add(-window)) {
+		attempt.Attempts = 0
+	}
+	attempt.Attempts++
+	attempt.LastTry = now
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (r *fakeLoginAttempts) BlockLogin(email string, threshold int, until time.Time) (*authDomain.LoginAttempt, error) {
+	attempt, ok := r.attempts[email]
+	if !ok || attempt.Attempts < threshold {
+		return nil, nil
+	}
+
+	attempt.Attempts = 0
+	attempt.BlockedAt = time.Now()
+	attempt.BlockedUntil = until
+	attempt.Lockouts++
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (r *fakeLoginAttempts) ResetLoginAttempts(email string) error {
+	delete(r.attempts, email)
+	return nil
+}
+
+// newTestUsecase returns a usecase with the user u1, who started enrolling
+// in MFA with the returned secret. Logins lock out after 3 failures and need
+// a challenge after 3 failures to the account or 10 from an address.
+func newTestUsecase(t *testing.T) (*AuthUsecase, *fakeUserRepo, string) {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeUserRepo{user: &domain.User{ID: "u1", Email: "user@example.com", MFASecret: secret}}
+	u := &AuthUsecase{
+		userRepo:      repo,
+		loginAttempts: &fakeLoginAttempts{},
+		notifier:      notify.NewLogNotifier(),
+		lockout:       authDomain.LockoutPolicy{Threshold: 3, Duration: time.Minute, MaxDuration: time.Hour},
+		challenge:     authDomain.ChallengePolicy{AccountFailures: 3, IPFailures: 10},
+		loginFailures: ratelimit.NewCounter("login_failures", time.Hour, ratelimit.NewMemoryStore()),
+	}
+	return u, repo, secret
+}
+
+// unreadableStore fails to read any state.
+type unreadableStore struct {
+	ratelimit.Store
+}
+
+func (unreadableStore) Get(key string) (ratelimit.State, error) {
+	return ratelimit.State{}, errors.New("store unreachable")
+}
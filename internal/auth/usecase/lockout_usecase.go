@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// checkLockout rejects logins to an email address that is locked out. Unknown
+// addresses are locked out like any other, so accounts cannot be enumerated.
+func (u *AuthUsecase) checkLockout(email string) error {
+	attempt, err := u.loginAttempts.GetLoginAttempts(email)
+	if err != nil {
+		return err
+	}
+
+	if attempt != nil && time.Now().Before(attempt.BlockedUntil) {
+		remaining := time.Until(attempt.BlockedUntil).Round(time.Second)
+		return &ratelimit.LimitError{
+			Message:    fmt.Sprintf("too many failed logins, try again in %s", remaining),
+			RetryAfter: time.Until(attempt.BlockedUntil),
+		}
+	}
+
+	return nil
+}
+
+// recordFailedLogin counts a failed login and locks the email address out
+// once the policy threshold is reached. user is nil for unknown addresses.
+// Failures are logged, the login fails either way.
+func (u *AuthUsecase) recordFailedLogin(email string, user *domain.User) {
+	if u.lockout.Threshold < 1 {
+		return
+	}
+
+	attempt, err := u.loginAttempts.RecordFailedLogin(email, u.lockout.Window)
+	if err != nil {
+		log.Printf("Failed to record failed login of %s: %v", email, err)
+		return
+	}
+
+	if attempt.Attempts < u.lockout.Threshold {
+		return
+	}
+
+	duration, exceeded := u.lockout.LockoutDuration(attempt.Lockouts)
+	attempt, err = u.loginAttempts.BlockLogin(email, u.lockout.Threshold, time.Now().Add(duration))
+	if err != nil {
+		log.Printf("Failed to lock out %s: %v", email, err)
+		return
+	}
+
+	if attempt == nil || user == nil {
+		return
+	}
+
+	// Backing off any longer would hardly slow an attacker down, so the
+	// account can be set to stay locked until an operator unlocks it
+	if exceeded && u.lockout.LockAccount {
+		if err := u.lockAccount(user); err != nil {
+			log.Printf("Failed to lock account %s: %v", user.ID, err)
+		}
+		return
+	}
+
+	err = u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your account was temporarily locked",
+		Body: fmt.Sprintf("After %d failed login attempts your account was locked for %s. "+
+			"If this was not you, change your password once the lock ends.", u.lockout.Threshold, duration),
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %s of lockout: %v", user.ID, err)
+	}
+}
+
+func (u *AuthUsecase) lockAccount(user *domain.User) error {
+	if user.Status == domain.StatusLocked {
+		return nil
+	}
+
+	change, err := domain.NewStatusChange(user, domain.StatusLocked, "too many failed logins", "")
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.SetStatus(user.ID, change); err != nil {
+		return err
+	}
+
+	// Sessions that are already signed in may be the attacker's
+	if err := u.LogoutAll(user.ID); err != nil {
+		return err
+	}
+
+	return u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your account was locked",
+		Body: "Your account was locked after repeated failed login attempts. " +
+			"Contact support to unlock it, and change your password afterwards.",
+	})
+}
+
+// UnlockAccount lifts a lockout of the user, whether temporary or locking
+// the account, on behalf of the operator actorID.
+func (u *AuthUsecase) UnlockAccount(actorID, userID string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	attempt, err := u.loginAttempts.GetLoginAttempts(user.Email)
+	if err != nil {
+		return err
+	}
+
+	locked := user.Status == domain.StatusLocked
+	if !locked && (attempt == nil || time.Now().After(attempt.BlockedUntil)) {
+		return errors.New("user is not locked")
+	}
+
+	if err := u.loginAttempts.ResetLoginAttempts(user.Email); err != nil {
+		return err
+	}
+
+	if locked {
+		change, err := domain.NewStatusChange(user, user.UsableStatus(), "unlocked", actorID)
+		if err != nil {
+			return err
+		}
+
+		if err := u.userRepo.SetStatus(user.ID, change); err != nil {
+			return err
+		}
+	}
+
+	return u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your account was unlocked",
+		Body:    "Your account was unlocked and you can log in again.",
+	})
+}
@@ -0,0 +1,280 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/jwt"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/totp"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+const (
+	mfaChallengeExpiry = 5 * time.Minute
+	recoveryCodeCount  = 10
+
+	// Wrong codes an MFA token takes before the password has to be entered
+	// again
+	mfaTokenFailures = 3
+)
+
+func (u *AuthUsecase) EnrollMFA(userID string) (string, string, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return "", "", errors.New("user not found")
+	}
+
+	if user.MFAEnabled {
+		return "", "", errors.New("MFA is already enabled")
+	}
+
+	// Store the secret as pending until a code is confirmed
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	user.MFASecret = secret
+	user.MFALastStep = 0
+	user.MFARecoveryCodes = nil
+	if err := u.userRepo.UpdateMFA(user); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(u.mfaIssuer, user.Email, secret), nil
+}
+
+func (u *AuthUsecase) ConfirmMFA(userID, code string, client authDomain.ClientInfo) ([]string, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if err := u.checkLockout(user.Email); err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, errors.New("MFA is already enabled")
+	}
+
+	if user.MFASecret == "" {
+		return nil, errors.New("MFA enrollment has not been started")
+	}
+
+	step, err := u.useEnrollmentCode(user, code)
+	if err != nil {
+		if isWrongMFACode(err) {
+			u.countFailedCode(user, client)
+		}
+		return nil, err
+	}
+
+	// Recovery codes are shown once, only their hashes are kept
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	user.MFAEnabled = true
+	user.MFALastStep = step
+	user.MFARecoveryCodes = hashes
+	if err := u.userRepo.UpdateMFA(user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (u *AuthUsecase) DisableMFA(userID, code string, client authDomain.ClientInfo) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.checkLockout(user.Email); err != nil {
+		return err
+	}
+
+	if !user.MFAEnabled {
+		return errors.New("MFA is not enabled")
+	}
+
+	if err := u.verifyMFACode(user, code); err != nil {
+		if isWrongMFACode(err) {
+			u.countFailedCode(user, client)
+		}
+		return err
+	}
+
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFALastStep = 0
+	user.MFARecoveryCodes = nil
+	return u.userRepo.UpdateMFA(user)
+}
+
+func (u *AuthUsecase) VerifyMFA(mfaToken, code string, client authDomain.ClientInfo) (*authDomain.TokenPair, error) {
+	claims, err := u.keys.Verify(mfaToken)
+	if err != nil || claims.Scope != jwt.ScopeMFA {
+		return nil, errors.New("invalid MFA token")
+	}
+
+	user, err := u.userRepo.FindByID(claims.UserID)
+	if err != nil || !user.MFAEnabled {
+		return nil, errors.New("invalid MFA token")
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		return nil, err
+	}
+
+	// Wrong codes count as failed logins, so guessing codes runs into the
+	// same lockout as guessing passwords
+	if err := u.checkLockout(user.Email); err != nil {
+		return nil, err
+	}
+
+	if u.mfaTokenSpent(claims.ID) {
+		return nil, errors.New("invalid MFA token")
+	}
+
+	if err := u.verifyMFACode(user, code); err != nil {
+		if isWrongMFACode(err) {
+			u.countMFAFailure(claims.ID, user, client)
+		}
+		return nil, err
+	}
+
+	tokens, err := u.startSession(user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reset login attempts on successful login
+	u.loginAttempts.ResetLoginAttempts(user.Email)
+	u.resetLoginFailures(user.Email)
+
+	return tokens, nil
+}
+
+// mfaTokenSpent reports whether an MFA token took too many wrong codes.
+// When the count cannot be read the token is accepted, the lockout still
+// applies.
+func (u *AuthUsecase) mfaTokenSpent(tokenID string) bool {
+	count, err := u.loginFailures.Count("mfa_token:" + tokenID)
+	if err != nil {
+		log.Printf("Failed to read failed MFA codes of token %s: %v", tokenID, err)
+		return false
+	}
+
+	return count >= mfaTokenFailures
+}
+
+// countMFAFailure counts a wrong code against the MFA token and as a failed
+// login of the account and client.
+func (u *AuthUsecase) countMFAFailure(tokenID string, user *domain.User, client authDomain.ClientInfo) {
+	if _, err := u.loginFailures.Add("mfa_token:" + tokenID); err != nil {
+		log.Printf("Failed to count failed MFA code of token %s: %v", tokenID, err)
+	}
+
+	u.countFailedCode(user, client)
+}
+
+// countFailedCode counts a wrong code as a failed login of the account and
+// client, so guessing codes runs into the lockout and login challenges.
+func (u *AuthUsecase) countFailedCode(user *domain.User, client authDomain.ClientInfo) {
+	u.recordFailedLogin(user.Email, user)
+	u.countLoginFailure(user.Email, client)
+}
+
+// isWrongMFACode reports whether err rejected the code itself.
+func isWrongMFACode(err error) bool {
+	return errors.Is(err, authDomain.ErrInvalidMFACode) || errors.Is(err, authDomain.ErrMFACodeUsed)
+}
+
+func (u *AuthUsecase) issueMFAChallenge(user *domain.User) (string, error) {
+	claims := jwt.NewClaims(user.ID, user.Email, "", mfaChallengeExpiry)
+	claims.Scope = jwt.ScopeMFA
+
+	return u.keys.Sign(claims)
+}
+
+// useEnrollmentCode accepts a current TOTP code of a pending enrollment and
+// returns its step. A code seen by someone else cannot confirm the
+// enrollment again.
+func (u *AuthUsecase) useEnrollmentCode(user *domain.User, code string) (int64, error) {
+	step, ok := totp.Validate(user.MFASecret, code, time.Now())
+	if !ok {
+		return 0, authDomain.ErrInvalidMFACode
+	}
+
+	fresh, err := u.userRepo.UseMFAStep(user.ID, step)
+	if err != nil {
+		return 0, err
+	}
+
+	if !fresh {
+		return 0, authDomain.ErrMFACodeUsed
+	}
+	return step, nil
+}
+
+// verifyMFACode accepts either a current TOTP code or an unused recovery
+// code. Both are single use.
+func (u *AuthUsecase) verifyMFACode(user *domain.User, code string) error {
+	if step, ok := totp.Validate(user.MFASecret, code, time.Now()); ok {
+		fresh, err := u.userRepo.UseMFAStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+
+		if !fresh {
+			return authDomain.ErrMFACodeUsed
+		}
+		return nil
+	}
+
+	used, err := u.userRepo.UseRecoveryCode(user.ID, securetoken.Hash(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return authDomain.ErrInvalidMFACode
+	}
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes formatted as xxxx-xxxx-xxxx together
+// with the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))[:12]
+		codes[i] = raw[:4] + "-" + raw[4:8] + "-" + raw[8:]
+		hashes[i] = securetoken.Hash(raw)
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/totp"
+)
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestConfirmMFARejectsReplay(t *testing.T) {
+	u, repo, secret := newTestUsecase(t)
+	code := currentCode(t, secret)
+
+	// The code was already spent, for example by a concurrent confirmation
+	repo.user.MFALastStep = time.Now().Unix() / 30
+	if _, err := u.ConfirmMFA("u1", code, authDomain.ClientInfo{}); !errors.Is(err, authDomain.ErrMFACodeUsed) {
+		t.Fatalf("err = %v, want ErrMFACodeUsed", err)
+	}
+	if repo.user.MFAEnabled {
+		t.Fatal("MFA was enabled with a spent code")
+	}
+
+	repo.user.MFALastStep = 0
+	codes, err := u.ConfirmMFA("u1", code, authDomain.ClientInfo{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || !repo.user.MFAEnabled {
+		t.Fatalf("MFA not enabled, got %d recovery codes", len(codes))
+	}
+
+	// The code that confirmed the enrollment cannot be used again
+	if err := u.DisableMFA("u1", code, authDomain.ClientInfo{}); !errors.Is(err, authDomain.ErrMFACodeUsed) {
+		t.Errorf("err = %v, want ErrMFACodeUsed", err)
+	}
+}
+
+func TestVerifyMFACodeRejectsReplay(t *testing.T) {
+	u, repo, secret := newTestUsecase(t)
+	repo.user.MFAEnabled = true
+
+	previous, err := totp.GenerateCode(secret, time.Now().Add(-30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := currentCode(t, secret)
+
+	if err := u.verifyMFACode(repo.user, code); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := u.verifyMFACode(repo.user, code); !errors.Is(err, authDomain.ErrMFACodeUsed) {
+		t.Errorf("replayed code: err = %v, want ErrMFACodeUsed", err)
+	}
+
+	// Codes of earlier steps are still within the drift window, but older
+	// than the one used
+	if previous != code {
+		if err := u.verifyMFACode(repo.user, previous); !errors.Is(err, authDomain.ErrMFACodeUsed) {
+			t.Errorf("earlier code: err = %v, want ErrMFACodeUsed", err)
+		}
+	}
+}
+
+func TestVerifyMFACodeRecoveryCodes(t *testing.T) {
+	u, repo, _ := newTestUsecase(t)
+	repo.user.MFAEnabled = true
+	repo.user.MFARecoveryCodes = []string{securetoken.Hash("abcdefghijkl")}
+
+	if err := u.verifyMFACode(repo.user, "ABCD-efgh-ijkl"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := u.verifyMFACode(repo.user, "abcd-efgh-ijkl"); !errors.Is(err, authDomain.ErrInvalidMFACode) {
+		t.Errorf("reused recovery code: err = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestMFATokenSpentAfterFailures(t *testing.T) {
+	u, repo, _ := newTestUsecase(t)
+	client := authDomain.ClientInfo{IP: "192.0.2.1"}
+
+	for i := 0; i < mfaTokenFailures; i++ {
+		if u.mfaTokenSpent("token1") {
+			t.Fatalf("token spent after %d failures", i)
+		}
+		u.countMFAFailure("token1", repo.user, client)
+	}
+
+	if !u.mfaTokenSpent("token1") {
+		t.Error("token still usable after the failure limit")
+	}
+	if u.mfaTokenSpent("token2") {
+		t.Error("failures of one token spent another")
+	}
+
+	// The failures also count as failed logins, so the next login of the
+	// account needs a challenge
+	if !u.loginChallengeRequired(repo.user.Email, client) {
+		t.Error("failed MFA codes did not count as failed logins")
+	}
+}
+
+func TestWrongMFACodesLockOut(t *testing.T) {
+	client := authDomain.ClientInfo{IP: "192.0.2.1"}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		call    func(u *AuthUsecase, code string) error
+	}{
+		{"confirm", false, func(u *AuthUsecase, code string) error {
+			_, err := u.ConfirmMFA("u1", code, client)
+			return err
+		}},
+		{"disable", true, func(u *AuthUsecase, code string) error {
+			return u.DisableMFA("u1", code, client)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, repo, secret := newTestUsecase(t)
+			repo.user.MFAEnabled = tt.enabled
+
+			for i := 0; i < u.lockout.Threshold; i++ {
+				if err := tt.call(u, "000000-wrong"); !errors.Is(err, authDomain.ErrInvalidMFACode) {
+					t.Fatalf("wrong code %d: err = %v, want ErrInvalidMFACode", i+1, err)
+				}
+			}
+
+			// Even the right code is turned away during the lockout
+			err := tt.call(u, currentCode(t, secret))
+			var limitErr *ratelimit.LimitError
+			if !errors.As(err, &limitErr) || limitErr.RetryAfter <= 0 {
+				t.Fatalf("err = %v after %d wrong codes, want a lockout", err, u.lockout.Threshold)
+			}
+			if repo.user.MFAEnabled != tt.enabled {
+				t.Error("MFA changed during the lockout")
+			}
+
+			// The wrong codes also count towards the login challenge
+			if !u.loginChallengeRequired(repo.user.Email, client) {
+				t.Error("wrong codes did not count as failed logins")
+			}
+		})
+	}
+}
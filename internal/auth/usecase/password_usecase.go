@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/validator"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePassword replaces the password of a signed in user. Every other
+// session is signed out. When keepSession is set the calling session
+// survives and gets a fresh token pair, otherwise nil tokens are returned.
+func (u *AuthUsecase) ChangePassword(userID, sessionID, currentPassword, newPassword string, keepSession bool) (*authDomain.TokenPair, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// Compare password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return nil, errors.New("current password is incorrect")
+	}
+
+	// Validate password
+	if err := validator.ValidatePassword(newPassword); err != nil {
+		return nil, err
+	}
+
+	if currentPassword == newPassword {
+		return nil, errors.New("new password must be different from the current password")
+	}
+
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.userRepo.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		return nil, err
+	}
+
+	// Pending reset tokens were issued for the old password
+	if err := u.authRepo.InvalidatePasswordResets(user.ID); err != nil {
+		return nil, err
+	}
+
+	keepFamilyID := ""
+	if keepSession && sessionID != "" {
+		keepFamilyID = sessionID
+	}
+
+	if err := u.logoutAllExcept(user.ID, keepFamilyID); err != nil {
+		return nil, err
+	}
+
+	// The password is changed already, a missing notice must not fail it
+	err = u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    "Your password was changed. If this was not you, reset your password immediately.",
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %s of password change: %v", user.ID, err)
+	}
+
+	if keepFamilyID == "" {
+		return nil, nil
+	}
+
+	// The tokens of the kept session were issued before the change, replace
+	// them and revoke the refresh token the session held
+	tokens, err := u.issueTokenPair(user, keepFamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.authRepo.RevokeRefreshFamilyExcept(keepFamilyID, securetoken.Hash(tokens.RefreshToken)); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (u *AuthUsecase) RequestPasswordReset(email string) error {
+	// Check rate limit
+	if err := u.checkRateLimit("reset:"+email, "too many password reset requests, please try again later"); err != nil {
+		return err
+	}
+
+	// Unknown addresses succeed silently so accounts cannot be enumerated
+	user, err := u.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	return u.sendPasswordReset(user)
+}
+
+// ForcePasswordReset signs the user out everywhere and blocks logins until
+// the password is reset with the token sent to them.
+func (u *AuthUsecase) ForcePasswordReset(userID string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.userRepo.RequirePasswordReset(user.ID); err != nil {
+		return err
+	}
+
+	if err := u.LogoutAll(user.ID); err != nil {
+		return err
+	}
+
+	return u.sendPasswordReset(user)
+}
+
+func (u *AuthUsecase) sendPasswordReset(user *domain.User) error {
+	token, err := securetoken.Generate()
+	if err != nil {
+		return err
+	}
+
+	err = u.authRepo.CreatePasswordReset(&authDomain.OneTimeToken{
+		TokenHash: securetoken.Hash(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(u.resetExpiry),
+	})
+	if err != nil {
+		return err
+	}
+
+	return u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this token to reset your password: %s\n"+
+			"It expires in %s. If you did not ask for a reset, ignore this message.", token, u.resetExpiry),
+	})
+}
+
+func (u *AuthUsecase) ResetPassword(token, newPassword string) error {
+	// Validate password
+	if err := validator.ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	// Consume the reset token so it can only be used once
+	reset, err := u.authRepo.UsePasswordReset(securetoken.Hash(token))
+	if err != nil {
+		return err
+	}
+
+	if reset == nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	user, err := u.userRepo.FindByID(reset.UserID)
+	if err != nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	// Other reset tokens and every existing session die with the old password
+	if err := u.authRepo.InvalidatePasswordResets(user.ID); err != nil {
+		return err
+	}
+
+	if err := u.LogoutAll(user.ID); err != nil {
+		return err
+	}
+
+	err = u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    "Your password was reset and all sessions were signed out.",
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %s of password reset: %v", user.ID, err)
+	}
+
+	return nil
+}
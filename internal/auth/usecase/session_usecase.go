@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"errors"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// Last seen times are written at most this often per session
+const sessionTouchInterval = time.Minute
+
+func (u *AuthUsecase) ListSessions(userID string) ([]*authDomain.Session, error) {
+	return u.authRepo.ListSessions(userID)
+}
+
+func (u *AuthUsecase) RevokeSession(userID, sessionID string) error {
+	session, err := u.authRepo.FindSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session == nil || session.UserID != userID {
+		return errors.New("session not found")
+	}
+
+	return u.revokeSession(sessionID)
+}
+
+// TouchSession records that the session was just used.
+func (u *AuthUsecase) TouchSession(sessionID string) error {
+	return u.authRepo.TouchSession(sessionID, sessionTouchInterval)
+}
+
+// startSession records a new session for the client and issues its first
+// token pair.
+func (u *AuthUsecase) startSession(user *domain.User, client authDomain.ClientInfo) (*authDomain.TokenPair, error) {
+	sessionID, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.authRepo.CreateSession(&authDomain.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: time.Now().Add(u.refreshExpiry),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u.issueTokenPair(user, sessionID)
+}
+
+// revokeSession ends the session, rejecting its access tokens and its
+// refresh token family.
+func (u *AuthUsecase) revokeSession(sessionID string) error {
+	if err := u.authRepo.RevokeSession(sessionID); err != nil {
+		return err
+	}
+
+	return u.authRepo.RevokeRefreshFamily(sessionID)
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	authDomain "github.com/nightnice1st/testGridWhiz/internal/auth/domain"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func (u *AuthUsecase) VerifyEmail(token string) error {
+	// Consume the verification token so it can only be used once
+	verification, err := u.authRepo.UseEmailVerification(securetoken.Hash(token))
+	if err != nil {
+		return err
+	}
+
+	if verification == nil {
+		return errors.New("invalid or expired verification token")
+	}
+
+	if err := u.userRepo.MarkEmailVerified(verification.UserID); err != nil {
+		return err
+	}
+
+	if err := u.activate(verification.UserID); err != nil {
+		return err
+	}
+
+	return u.authRepo.InvalidateEmailVerifications(verification.UserID)
+}
+
+func (u *AuthUsecase) ResendVerification(email string) error {
+	// Check rate limit
+	if err := u.checkRateLimit("verify:"+email, "too many verification requests, please try again later"); err != nil {
+		return err
+	}
+
+	// Unknown or verified addresses succeed silently so accounts cannot be
+	// enumerated
+	user, err := u.userRepo.FindByEmail(email)
+	if err != nil || user.EmailVerified {
+		return nil
+	}
+
+	// Only the latest token stays valid
+	if err := u.authRepo.InvalidateEmailVerifications(user.ID); err != nil {
+		return err
+	}
+
+	return u.sendVerification(user)
+}
+
+func (u *AuthUsecase) sendVerification(user *domain.User) error {
+	token, err := securetoken.Generate()
+	if err != nil {
+		return err
+	}
+
+	err = u.authRepo.CreateEmailVerification(&authDomain.OneTimeToken{
+		TokenHash: securetoken.Hash(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(u.verifyExpiry),
+	})
+	if err != nil {
+		return err
+	}
+
+	return u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Use this token to verify your email address: %s\n"+
+			"It expires in %s.", token, u.verifyExpiry),
+	})
+}
+
+// activate moves a pending account to active once its email address is
+// verified. Accounts in any other status keep it.
+func (u *AuthUsecase) activate(userID string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Status != domain.StatusPending {
+		return nil
+	}
+
+	change, err := domain.NewStatusChange(user, domain.StatusActive, "email address verified", "")
+	if err != nil {
+		return err
+	}
+
+	return u.userRepo.SetStatus(user.ID, change)
+}
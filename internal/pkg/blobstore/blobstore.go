@@ -0,0 +1,32 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps binary objects, such as uploaded images, under
+// slash-separated keys.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any existing blob.
+	Put(key string, r io.Reader) error
+	// Get opens the blob stored under key. It returns ErrNotFound when there
+	// is none.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(key string) error
+}
+
+// New returns the store selected by kind, either "gridfs", keeping blobs in
+// the bucket of db, or "local", keeping them as files below dir.
+func New(kind, dir string, db *mongo.Database, bucket string) (BlobStore, error) {
+	if kind == "gridfs" {
+		return NewGridFSStore(db, bucket)
+	}
+	return NewLocalStore(dir)
+}
@@ -0,0 +1,55 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSStore keeps blobs in a GridFS bucket, so every instance of a service
+// sees the same blobs. The key is used as both the file ID and name.
+type GridFSStore struct {
+	bucket *gridfs.Bucket
+}
+
+func NewGridFSStore(db *mongo.Database, name string) (*GridFSStore, error) {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(name))
+	if err != nil {
+		return nil, err
+	}
+	return &GridFSStore{bucket: bucket}, nil
+}
+
+func (s *GridFSStore) Put(key string, r io.Reader) error {
+	// File IDs are unique, so an existing blob is removed first
+	if err := s.Delete(key); err != nil {
+		return err
+	}
+
+	return s.bucket.UploadFromStreamWithID(key, key, r)
+}
+
+func (s *GridFSStore) Get(key string) (io.ReadCloser, error) {
+	stream, err := s.bucket.OpenDownloadStream(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+func (s *GridFSStore) Delete(key string) error {
+	err := s.bucket.Delete(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -3,19 +3,61 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	MongoDBURI        string
-	JWTSecret         string
-	JWTExpiry         time.Duration
-	AuthServicePort   string
-	UserServicePort   string
-	RateLimitAttempts int
-	RateLimitWindow   time.Duration
+	MongoDBURI         string
+	JWTSecret          string
+	JWTSigningAlg      string
+	JWTKeysDir         string
+	JWTKeyRotation     time.Duration
+	JWTKeyOverlap      time.Duration
+	JWKSURL            string
+	JWKSRefresh        time.Duration
+	JWTExpiry          time.Duration
+	RefreshExpiry      time.Duration
+	MFAIssuer          string
+	PasswordResetTTL   time.Duration
+	EmailVerifyTTL     time.Duration
+	EmailChangeTTL     time.Duration
+	UnverifiedLogin    string
+	AdminEmails        []string
+	DeletionGrace      time.Duration
+	PurgeInterval      time.Duration
+	DataExportInterval time.Duration
+	AvatarStore        string
+	AvatarDir          string
+	AvatarMaxSize      int64
+	Notifier           string
+	NotifierFile       string
+	AuthServicePort    string
+	UserServicePort    string
+	JWKSHTTPPort       string
+	RateLimitAttempts  int
+	RateLimitWindow    time.Duration
+	RateLimitStore     string
+	RateLimitAlgorithm string
+	RateLimitQuotas    string
+	RateLimitReload    time.Duration
+	RedisAddr          string
+	RedisPassword      string
+	LockoutThreshold   int
+	LockoutWindow      time.Duration
+	LockoutDuration    time.Duration
+	LockoutMaxDuration time.Duration
+	LockoutLockAccount bool
+
+	ChallengeAccountFailures int
+	ChallengeIPFailures      int
+	ChallengeSubnetFailures  int
+	ChallengeWindow          time.Duration
+	ChallengeDifficulty      int
+	ChallengeExpiry          time.Duration
 }
 
 func Load() *Config {
@@ -24,15 +66,128 @@ func Load() *Config {
 	}
 
 	jwtExpiry, _ := time.ParseDuration(os.Getenv("JWT_EXPIRY"))
+	jwtKeyRotation, _ := time.ParseDuration(os.Getenv("JWT_KEY_ROTATION"))
+	jwtKeyOverlap, _ := time.ParseDuration(os.Getenv("JWT_KEY_OVERLAP"))
+	jwksRefresh, _ := time.ParseDuration(os.Getenv("JWKS_REFRESH"))
+	refreshExpiry, _ := time.ParseDuration(os.Getenv("REFRESH_TOKEN_EXPIRY"))
+	passwordResetTTL, _ := time.ParseDuration(os.Getenv("PASSWORD_RESET_EXPIRY"))
+	emailVerifyTTL, _ := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_EXPIRY"))
+	emailChangeTTL, _ := time.ParseDuration(os.Getenv("EMAIL_CHANGE_EXPIRY"))
+	purgeInterval, _ := time.ParseDuration(os.Getenv("ACCOUNT_PURGE_INTERVAL"))
 	rateLimitWindow, _ := time.ParseDuration(os.Getenv("RATE_LIMIT_WINDOW"))
+	rateLimitReload, _ := time.ParseDuration(os.Getenv("RATE_LIMIT_QUOTAS_RELOAD"))
+	lockoutThreshold, _ := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD"))
+	lockoutWindow, _ := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_WINDOW"))
+	lockoutDuration, _ := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION"))
+	lockoutLockAccount, _ := strconv.ParseBool(os.Getenv("LOGIN_LOCKOUT_LOCK_ACCOUNT"))
+	challengeAccountFailures, _ := strconv.Atoi(os.Getenv("LOGIN_CHALLENGE_ACCOUNT_FAILURES"))
+	challengeIPFailures, _ := strconv.Atoi(os.Getenv("LOGIN_CHALLENGE_IP_FAILURES"))
+	challengeSubnetFailures, _ := strconv.Atoi(os.Getenv("LOGIN_CHALLENGE_SUBNET_FAILURES"))
+	challengeWindow, _ := time.ParseDuration(os.Getenv("LOGIN_CHALLENGE_WINDOW"))
+	challengeDifficulty, _ := strconv.Atoi(os.Getenv("LOGIN_CHALLENGE_DIFFICULTY"))
+	challengeExpiry, _ := time.ParseDuration(os.Getenv("LOGIN_CHALLENGE_EXPIRY"))
+
+	// Without a grace period the purger would delete every account as soon
+	// as it is deleted, leaving nothing to restore
+	deletionGrace := 720 * time.Hour
+	if value := os.Getenv("ACCOUNT_DELETION_GRACE"); value != "" {
+		grace, err := time.ParseDuration(value)
+		if err != nil || grace <= 0 {
+			log.Fatalf("Invalid ACCOUNT_DELETION_GRACE %q: must be a positive duration", value)
+		}
+		deletionGrace = grace
+	}
+
+	// Users can export their data once an interval, a zero window would
+	// fail the limiter
+	dataExportInterval := time.Hour
+	if value := os.Getenv("DATA_EXPORT_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid DATA_EXPORT_INTERVAL %q: must be a positive duration", value)
+		}
+		dataExportInterval = interval
+	}
+
+	// Without a limit every avatar upload would be rejected
+	avatarMaxSize := int64(5 << 20)
+	if value := os.Getenv("AVATAR_MAX_SIZE"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			log.Fatalf("Invalid AVATAR_MAX_SIZE %q: must be a positive number of bytes", value)
+		}
+		avatarMaxSize = size
+	}
+
+	// Lockouts double up to the longest one, so it cannot be shorter than
+	// the first
+	lockoutMaxDuration := 24 * time.Hour
+	if value := os.Getenv("LOGIN_LOCKOUT_MAX_DURATION"); value != "" {
+		maxDuration, err := time.ParseDuration(value)
+		if err != nil || maxDuration <= 0 {
+			log.Fatalf("Invalid LOGIN_LOCKOUT_MAX_DURATION %q: must be a positive duration", value)
+		}
+		lockoutMaxDuration = maxDuration
+	}
+	if lockoutMaxDuration < lockoutDuration {
+		log.Fatalf("Invalid LOGIN_LOCKOUT_MAX_DURATION %v: must not be shorter than LOGIN_LOCKOUT_DURATION %v",
+			lockoutMaxDuration, lockoutDuration)
+	}
+
+	var adminEmails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			adminEmails = append(adminEmails, email)
+		}
+	}
 
 	return &Config{
-		MongoDBURI:        os.Getenv("MONGODB_URI"),
-		JWTSecret:         os.Getenv("JWT_SECRET"),
-		JWTExpiry:         jwtExpiry,
-		AuthServicePort:   os.Getenv("AUTH_SERVICE_PORT"),
-		UserServicePort:   os.Getenv("USER_SERVICE_PORT"),
-		RateLimitAttempts: 5,
-		RateLimitWindow:   rateLimitWindow,
+		MongoDBURI:         os.Getenv("MONGODB_URI"),
+		JWTSecret:          os.Getenv("JWT_SECRET"),
+		JWTSigningAlg:      os.Getenv("JWT_SIGNING_ALG"),
+		JWTKeysDir:         os.Getenv("JWT_KEYS_DIR"),
+		JWTKeyRotation:     jwtKeyRotation,
+		JWTKeyOverlap:      jwtKeyOverlap,
+		JWKSURL:            os.Getenv("JWKS_URL"),
+		JWKSRefresh:        jwksRefresh,
+		JWTExpiry:          jwtExpiry,
+		RefreshExpiry:      refreshExpiry,
+		MFAIssuer:          os.Getenv("MFA_ISSUER"),
+		PasswordResetTTL:   passwordResetTTL,
+		EmailVerifyTTL:     emailVerifyTTL,
+		EmailChangeTTL:     emailChangeTTL,
+		UnverifiedLogin:    os.Getenv("UNVERIFIED_LOGIN"),
+		AdminEmails:        adminEmails,
+		DeletionGrace:      deletionGrace,
+		PurgeInterval:      purgeInterval,
+		DataExportInterval: dataExportInterval,
+		AvatarStore:        os.Getenv("AVATAR_STORE"),
+		AvatarDir:          os.Getenv("AVATAR_DIR"),
+		AvatarMaxSize:      avatarMaxSize,
+		Notifier:           os.Getenv("NOTIFIER"),
+		NotifierFile:       os.Getenv("NOTIFIER_FILE"),
+		AuthServicePort:    os.Getenv("AUTH_SERVICE_PORT"),
+		UserServicePort:    os.Getenv("USER_SERVICE_PORT"),
+		JWKSHTTPPort:       os.Getenv("JWKS_HTTP_PORT"),
+		RateLimitAttempts:  5,
+		RateLimitWindow:    rateLimitWindow,
+		RateLimitStore:     os.Getenv("RATE_LIMIT_STORE"),
+		RateLimitAlgorithm: os.Getenv("RATE_LIMIT_ALGORITHM"),
+		RateLimitQuotas:    os.Getenv("RATE_LIMIT_QUOTAS_FILE"),
+		RateLimitReload:    rateLimitReload,
+		RedisAddr:          os.Getenv("REDIS_ADDR"),
+		RedisPassword:      os.Getenv("REDIS_PASSWORD"),
+		LockoutThreshold:   lockoutThreshold,
+		LockoutWindow:      lockoutWindow,
+		LockoutDuration:    lockoutDuration,
+		LockoutMaxDuration: lockoutMaxDuration,
+		LockoutLockAccount: lockoutLockAccount,
+
+		ChallengeAccountFailures: challengeAccountFailures,
+		ChallengeIPFailures:      challengeIPFailures,
+		ChallengeSubnetFailures:  challengeSubnetFailures,
+		ChallengeWindow:          challengeWindow,
+		ChallengeDifficulty:      challengeDifficulty,
+		ChallengeExpiry:          challengeExpiry,
 	}
 }
@@ -0,0 +1,257 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JSONWebKey is the public half of a signing key as described in RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func publicJWK(key *Key) (JSONWebKey, bool) {
+	jwk := JSONWebKey{
+		KeyID:     key.ID,
+		Use:       "sig",
+		Algorithm: key.Algorithm,
+	}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeBase64(pub.N.Bytes())
+		jwk.E = encodeBase64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = encodeBase64(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encodeBase64(pub)
+	default:
+		// Symmetric keys are never published
+		return JSONWebKey{}, false
+	}
+
+	return jwk, true
+}
+
+func (k JSONWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBase64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// JWKSHandler serves the public keys of ring as a JWKS document.
+func JWKSHandler(ring KeySet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(ring.JWKS())
+	})
+}
+
+// RemoteKeySet verifies tokens against the JWKS published by the token
+// issuer. It cannot sign tokens. The document is refetched once it is older
+// than refresh, or sooner when a token names an unknown kid.
+type RemoteKeySet struct {
+	url       string
+	refresh   time.Duration
+	client    *http.Client
+	mu        sync.RWMutex
+	set       *JSONWebKeySet
+	keys      map[string]*Key
+	fetchedAt time.Time
+}
+
+// Unknown kids trigger a refetch at most this often
+const minRefetchInterval = 30 * time.Second
+
+func NewRemoteKeySet(url string, refresh time.Duration) *RemoteKeySet {
+	if refresh < minRefetchInterval {
+		refresh = minRefetchInterval
+	}
+
+	return &RemoteKeySet{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		set:     &JSONWebKeySet{Keys: []JSONWebKey{}},
+		keys:    make(map[string]*Key),
+	}
+}
+
+func (s *RemoteKeySet) Sign(claims *Claims) (string, error) {
+	return "", errors.New("remote key set cannot sign tokens")
+}
+
+func (s *RemoteKeySet) Verify(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, s.lookup)
+}
+
+func (s *RemoteKeySet) JWKS() *JSONWebKeySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.set
+}
+
+func (s *RemoteKeySet) lookup(kid string) (*Key, error) {
+	s.mu.RLock()
+	key, ok, fresh := s.cached(kid)
+	s.mu.RUnlock()
+
+	if !fresh {
+		if err := s.fetch(kid); err != nil {
+			// Keep serving cached keys while the issuer is unreachable
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+
+		s.mu.RLock()
+		key, ok, _ = s.cached(kid)
+		s.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	return key, nil
+}
+
+// cached returns the cached key kid and whether the cache can answer for it
+// without a refetch. The caller holds mu.
+func (s *RemoteKeySet) cached(kid string) (key *Key, ok, fresh bool) {
+	key, ok = s.keys[kid]
+	age := time.Since(s.fetchedAt)
+
+	if ok {
+		return key, true, age < s.refresh
+	}
+	return nil, false, age < minRefetchInterval
+}
+
+// fetch refetches the JWKS unless a concurrent lookup already did while this
+// one waited for the lock, so lookups of the same or another unknown kid
+// share a single request.
+func (s *RemoteKeySet) fetch(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, _, fresh := s.cached(kid); fresh {
+		return nil
+	}
+
+	// Record the attempt first so a failing issuer is not hammered
+	s.fetchedAt = time.Now()
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch JWKS: unexpected status %s", resp.Status)
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if _, err := signingMethod(jwk.Algorithm); err != nil || jwk.Algorithm == AlgHS256 {
+			continue
+		}
+
+		pub, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.KeyID] = &Key{
+			ID:        jwk.KeyID,
+			Algorithm: jwk.Algorithm,
+			PublicKey: pub,
+		}
+	}
+
+	s.set = &set
+	s.keys = keys
+	return nil
+}
@@ -0,0 +1,249 @@
+package jwt
+
+import (
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKS(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		keyType   string
+		curve     string
+	}{
+		{AlgRS256, "RSA", ""},
+		{AlgES256, "EC", "P-256"},
+		{AlgEdDSA, "OKP", "Ed25519"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			r, err := NewKeyRing(tt.algorithm, 0, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			JWKSHandler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("content type = %q", ct)
+			}
+
+			var set JSONWebKeySet
+			if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+				t.Fatal(err)
+			}
+			if len(set.Keys) != 1 {
+				t.Fatalf("keys = %+v, want one", set.Keys)
+			}
+
+			jwk := set.Keys[0]
+			r.mu.RLock()
+			key := r.keys[0]
+			r.mu.RUnlock()
+			if jwk.KeyID != key.ID || jwk.KeyType != tt.keyType || jwk.Curve != tt.curve ||
+				jwk.Algorithm != tt.algorithm || jwk.Use != "sig" {
+				t.Errorf("key = %+v, want %s %s %s", jwk, key.ID, tt.keyType, tt.curve)
+			}
+
+			pub, err := jwk.publicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pub.(interface{ Equal(x crypto.PublicKey) bool }).Equal(key.PublicKey) {
+				t.Error("the published key differs from the signing key")
+			}
+		})
+	}
+}
+
+func TestJWKSRejectsUnsupportedKeys(t *testing.T) {
+	for _, jwk := range []JSONWebKey{
+		{KeyType: "EC", Curve: "P-384"},
+		{KeyType: "OKP", Curve: "Ed25519", X: "c2hvcnQ"},
+		{KeyType: "oct"},
+	} {
+		if _, err := jwk.publicKey(); err == nil {
+			t.Errorf("accepted %+v", jwk)
+		}
+	}
+}
+
+// newIssuer serves the JWKS of ring and counts the fetches.
+func newIssuer(t *testing.T, ring KeySet) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var fetches atomic.Int32
+	handler := JWKSHandler(ring)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &fetches
+}
+
+// expire makes the cached JWKS of s older than d.
+func expire(s *RemoteKeySet, d time.Duration) {
+	s.mu.Lock()
+	s.fetchedAt = time.Now().Add(-d)
+	s.mu.Unlock()
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	ring, err := NewKeyRing(AlgES256, time.Hour, 10*time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, fetches := newIssuer(t, ring)
+
+	remote := NewRemoteKeySet(srv.URL, time.Minute)
+	if _, err := remote.Sign(NewClaims("u1", "ada@example.com", "s1", time.Hour)); err == nil {
+		t.Error("a remote key set signed a token")
+	}
+
+	old := signTest(t, ring)
+	if claims, err := remote.Verify(old); err != nil || claims.UserID != "u1" {
+		t.Fatalf("verify = %+v, %v", claims, err)
+	}
+	if kids := jwksKeyIDs(remote.JWKS()); !kids[tokenKeyID(t, old)] {
+		t.Errorf("cached JWKS = %v, want the issuer's key", kids)
+	}
+
+	// Cached keys are used until the refresh interval has passed
+	remote.Verify(old)
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+
+	// An unknown kid refetches the JWKS, but not more often than
+	// minRefetchInterval
+	age(t, ring, 65*time.Minute)
+	current := signTest(t, ring)
+	if _, err := remote.Verify(current); err == nil {
+		t.Error("verified an unknown kid within the refetch interval")
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+
+	expire(remote, minRefetchInterval)
+	if _, err := remote.Verify(current); err != nil {
+		t.Fatalf("verify after the issuer rotated: %v", err)
+	}
+	if _, err := remote.Verify(old); err != nil {
+		t.Errorf("verify with the old key after the issuer rotated: %v", err)
+	}
+
+	// Cached keys keep verifying while the issuer is unreachable
+	srv.Close()
+	expire(remote, time.Hour)
+	if _, err := remote.Verify(current); err != nil {
+		t.Errorf("verify while the issuer is unreachable: %v", err)
+	}
+
+	other, err := GenerateKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := signToken(other, NewClaims("u1", "ada@example.com", "s1", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(remote, time.Hour)
+	if _, err := remote.Verify(token); err == nil {
+		t.Error("verified a token with an unknown kid")
+	}
+}
+
+func TestRemoteKeySetSharesRefetches(t *testing.T) {
+	ring, err := NewKeyRing(AlgES256, time.Hour, 10*time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, fetches := newIssuer(t, ring)
+
+	remote := NewRemoteKeySet(srv.URL, time.Minute)
+	if _, err := remote.Verify(signTest(t, ring)); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := GenerateKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := signToken(other, NewClaims("u1", "ada@example.com", "s1", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	age(t, ring, 65*time.Minute)
+	rotated := signTest(t, ring)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"rotated kid", rotated, false},
+		{"unknown kid", unknown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expire(remote, minRefetchInterval)
+			before := fetches.Load()
+
+			// Lookups waiting for the lock find the JWKS the first one
+			// fetched
+			var wg sync.WaitGroup
+			var failed atomic.Int32
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := remote.Verify(tt.token); err != nil {
+						failed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if n := fetches.Load() - before; n != 1 {
+				t.Errorf("fetches = %d, want 1", n)
+			}
+			if tt.wantErr && failed.Load() != 20 {
+				t.Errorf("%d of 20 lookups failed, want all", failed.Load())
+			}
+			if !tt.wantErr && failed.Load() != 0 {
+				t.Errorf("%d of 20 lookups failed", failed.Load())
+			}
+		})
+	}
+}
+
+func TestRemoteKeySetSkipsSymmetricKeys(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JSONWebKeySet{Keys: []JSONWebKey{
+			{KeyType: "oct", KeyID: "shared", Algorithm: AlgHS256},
+		}})
+	}))
+	defer srv.Close()
+
+	// A JWKS listing a symmetric key must not let the secret verify tokens
+	token, err := signToken(&Key{ID: "shared", Algorithm: AlgHS256, PrivateKey: []byte("secret")},
+		NewClaims("u1", "ada@example.com", "s1", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRemoteKeySet(srv.URL, time.Minute).Verify(token); err == nil {
+		t.Error("verified a token with a symmetric key from the JWKS")
+	}
+}
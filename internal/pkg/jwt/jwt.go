@@ -1,40 +1,88 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// ScopeMFA marks a short-lived challenge token issued after a correct
+	// password when a second factor is still required. It is not an access
+	// token.
+	ScopeMFA = "mfa"
+
+	// ScopeUnverified marks an access token of a user whose email address is
+	// not verified yet. It is only accepted by a few methods.
+	ScopeUnverified = "unverified"
+)
+
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    string   `json:"user_id"`
+	Email     string   `json:"email"`
+	SessionID string   `json:"sid,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID, email, secret string, expiry time.Duration) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+// KeySet signs and verifies tokens. Implementations that only hold public
+// keys return an error from Sign.
+type KeySet interface {
+	Sign(claims *Claims) (string, error)
+	Verify(tokenString string) (*Claims, error)
+	JWKS() *JSONWebKeySet
+}
+
+// NewClaims returns claims for a token with a random jti.
+func NewClaims(userID, email, sessionID string, expiry time.Duration) *Claims {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &Claims{
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        hex.EncodeToString(id),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+func signToken(key *Key, claims *Claims) (string, error) {
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	return token.SignedString(key.PrivateKey)
 }
 
-func ValidateToken(tokenString, secret string) (*Claims, error) {
+func parseToken(tokenString string, lookup func(kid string) (*Key, error)) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.Algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secret), nil
+		return key.PublicKey, nil
 	})
 
 	if err != nil {
@@ -0,0 +1,415 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+)
+
+// Key is a single signing key identified by its kid header. A key signs new
+// tokens between NotBefore and NotAfter and keeps verifying them until
+// ExpiresAt, which gives issued tokens time to expire after a rotation.
+// Zero NotAfter and ExpiresAt mean the key never rotates.
+type Key struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+	NotBefore  time.Time
+	NotAfter   time.Time
+	ExpiresAt  time.Time
+}
+
+func (k *Key) canSign(now time.Time) bool {
+	return k.PrivateKey != nil && !now.Before(k.NotBefore) &&
+		(k.NotAfter.IsZero() || now.Before(k.NotAfter))
+}
+
+func (k *Key) expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+// KeyRing holds the signing keys of the token issuer. Keys are rotated on a
+// schedule: the next key is published overlap before it starts signing and
+// the previous key keeps verifying for overlap after it stops, so verifiers
+// caching the JWKS never see an unknown kid.
+type KeyRing struct {
+	mu        sync.RWMutex
+	keys      []*Key
+	algorithm string
+	rotation  time.Duration
+	overlap   time.Duration
+	dir       string
+}
+
+// NewKeyRing loads the keys persisted in dir, creating the directory if
+// needed, and generates new keys whenever the schedule requires one. An
+// empty dir keeps keys in memory only.
+func NewKeyRing(algorithm string, rotation, overlap time.Duration, dir string) (*KeyRing, error) {
+	if _, err := signingMethod(algorithm); err != nil || algorithm == AlgHS256 {
+		return nil, fmt.Errorf("unsupported asymmetric signing algorithm %q", algorithm)
+	}
+
+	r := &KeyRing{
+		algorithm: algorithm,
+		rotation:  rotation,
+		overlap:   overlap,
+		dir:       dir,
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+
+		keys, err := loadKeys(dir)
+		if err != nil {
+			return nil, err
+		}
+		r.keys = keys
+	}
+
+	if err := r.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if rotation > 0 {
+		go r.schedule()
+	}
+	return r, nil
+}
+
+// NewHMACKeyRing returns a key ring backed by a single shared secret. Tokens
+// carry no kid so tokens issued before key rings existed stay valid.
+func NewHMACKeyRing(secret string) *KeyRing {
+	return &KeyRing{
+		keys: []*Key{{
+			Algorithm:  AlgHS256,
+			PrivateKey: []byte(secret),
+			PublicKey:  []byte(secret),
+		}},
+		algorithm: AlgHS256,
+	}
+}
+
+func (r *KeyRing) Sign(claims *Claims) (string, error) {
+	key, err := r.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	return signToken(key, claims)
+}
+
+func (r *KeyRing) Verify(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, r.verificationKey)
+}
+
+func (r *KeyRing) JWKS() *JSONWebKeySet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	now := time.Now()
+	for _, key := range r.keys {
+		if key.expired(now) {
+			continue
+		}
+
+		if jwk, ok := publicJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+func (r *KeyRing) signingKey() (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var current *Key
+	now := time.Now()
+	for _, key := range r.keys {
+		if key.canSign(now) && (current == nil || key.NotBefore.After(current.NotBefore)) {
+			current = key
+		}
+	}
+
+	if current == nil {
+		return nil, errors.New("no active signing key")
+	}
+
+	return current, nil
+}
+
+func (r *KeyRing) verificationKey(kid string) (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range r.keys {
+		if key.ID == kid && !key.expired(now) {
+			return key, nil
+		}
+	}
+
+	return nil, errors.New("unknown signing key")
+}
+
+func (r *KeyRing) schedule() {
+	// Check well within the overlap so the next key is always published
+	// before it starts signing
+	interval := time.Minute
+	if r.overlap > 0 && r.overlap/4 < interval {
+		interval = r.overlap / 4
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := r.rotate(now); err != nil {
+			log.Printf("Failed to rotate signing keys: %v", err)
+		}
+	}
+}
+
+// rotate drops expired keys and makes sure there is a key signing now and,
+// once the current key is within overlap of retiring, a published successor.
+func (r *KeyRing) rotate(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Drop keys that can no longer verify anything
+	active := r.keys[:0]
+	for _, key := range r.keys {
+		if key.expired(now) {
+			r.removeKey(key)
+			continue
+		}
+		active = append(active, key)
+	}
+	r.keys = active
+
+	var current, next *Key
+	for _, key := range r.keys {
+		if key.canSign(now) && (current == nil || key.NotBefore.After(current.NotBefore)) {
+			current = key
+		}
+	}
+
+	if current == nil {
+		key, err := r.addKey(now)
+		if err != nil {
+			return err
+		}
+		current = key
+	}
+
+	if current.NotAfter.IsZero() {
+		return nil
+	}
+
+	for _, key := range r.keys {
+		if !key.NotBefore.Before(current.NotAfter) {
+			next = key
+		}
+	}
+
+	if next == nil && current.NotAfter.Sub(now) <= r.overlap {
+		if _, err := r.addKey(current.NotAfter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *KeyRing) addKey(notBefore time.Time) (*Key, error) {
+	key, err := GenerateKey(r.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key.NotBefore = notBefore
+	if r.rotation > 0 {
+		key.NotAfter = notBefore.Add(r.rotation)
+		key.ExpiresAt = key.NotAfter.Add(r.overlap)
+	}
+
+	if r.dir != "" {
+		if err := saveKey(r.dir, key); err != nil {
+			return nil, err
+		}
+	}
+
+	r.keys = append(r.keys, key)
+	sort.Slice(r.keys, func(i, j int) bool {
+		return r.keys[i].NotBefore.Before(r.keys[j].NotBefore)
+	})
+
+	return key, nil
+}
+
+func (r *KeyRing) removeKey(key *Key) {
+	if r.dir != "" {
+		os.Remove(filepath.Join(r.dir, key.ID+".pem"))
+	}
+}
+
+// GenerateKey creates a new key pair for algorithm with a random kid.
+func GenerateKey(algorithm string) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:         hex.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: private,
+		PublicKey:  private.Public(),
+	}, nil
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgES256:
+		return jwt.SigningMethodES256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	case AlgHS256:
+		return jwt.SigningMethodHS256, nil
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// Keys are persisted as PKCS #8 PEM files named after their kid, with the
+// rotation schedule stored in the PEM headers.
+func saveKey(dir string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"Algorithm":  key.Algorithm,
+		"Not-Before": key.NotBefore.UTC().Format(time.RFC3339),
+	}
+	if !key.NotAfter.IsZero() {
+		headers["Not-After"] = key.NotAfter.UTC().Format(time.RFC3339)
+		headers["Expires-At"] = key.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	block := &pem.Block{Type: "PRIVATE KEY", Headers: headers, Bytes: der}
+	return os.WriteFile(filepath.Join(dir, key.ID+".pem"), pem.EncodeToMemory(block), 0o600)
+}
+
+func loadKeys(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			return nil, fmt.Errorf("%s: not a PEM encoded private key", path)
+		}
+
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported key type", path)
+		}
+
+		key := &Key{
+			ID:         strings.TrimSuffix(filepath.Base(path), ".pem"),
+			Algorithm:  block.Headers["Algorithm"],
+			PrivateKey: private,
+			PublicKey:  signer.Public(),
+		}
+
+		for header, field := range map[string]*time.Time{
+			"Not-Before": &key.NotBefore,
+			"Not-After":  &key.NotAfter,
+			"Expires-At": &key.ExpiresAt,
+		} {
+			if value, ok := block.Headers[header]; ok {
+				if *field, err = time.Parse(time.RFC3339, value); err != nil {
+					return nil, fmt.Errorf("%s: invalid %s header: %w", path, header, err)
+				}
+			}
+		}
+
+		if _, err := signingMethod(key.Algorithm); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].NotBefore.Before(keys[j].NotBefore)
+	})
+
+	return keys, nil
+}
@@ -0,0 +1,213 @@
+package jwt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// age moves the schedule of every key in r back by d, as if d had passed,
+// and rotates the ring like the scheduler would.
+func age(t *testing.T, r *KeyRing, d time.Duration) {
+	t.Helper()
+
+	r.mu.Lock()
+	for _, key := range r.keys {
+		key.NotBefore = key.NotBefore.Add(-d)
+		if !key.NotAfter.IsZero() {
+			key.NotAfter = key.NotAfter.Add(-d)
+			key.ExpiresAt = key.ExpiresAt.Add(-d)
+		}
+	}
+	r.mu.Unlock()
+
+	if err := r.rotate(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signTest(t *testing.T, set KeySet) string {
+	t.Helper()
+
+	token, err := set.Sign(NewClaims("u1", "ada@example.com", "s1", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func jwksKeyIDs(set *JSONWebKeySet) map[string]bool {
+	kids := make(map[string]bool)
+	for _, key := range set.Keys {
+		kids[key.KeyID] = true
+	}
+	return kids
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	r, err := NewKeyRing(AlgES256, time.Hour, 10*time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := signTest(t, r)
+	oldKid := tokenKeyID(t, old)
+	if claims, err := r.Verify(old); err != nil || claims.UserID != "u1" {
+		t.Fatalf("verify = %+v, %v", claims, err)
+	}
+
+	// The successor is published overlap before it starts signing
+	age(t, r, 55*time.Minute)
+	if kids := jwksKeyIDs(r.JWKS()); len(kids) != 2 || !kids[oldKid] {
+		t.Fatalf("JWKS before the rotation = %v, want the current key and its successor", kids)
+	}
+	if kid := tokenKeyID(t, signTest(t, r)); kid != oldKid {
+		t.Fatalf("signed with %s before the rotation, want %s", kid, oldKid)
+	}
+
+	// The successor signs, the old key still verifies
+	age(t, r, 10*time.Minute)
+	current := signTest(t, r)
+	if tokenKeyID(t, current) == oldKid {
+		t.Fatal("still signing with the old key after the rotation")
+	}
+	if _, err := r.Verify(old); err != nil {
+		t.Fatalf("verify with the old key after the rotation: %v", err)
+	}
+
+	// The old key is retired once the overlap has passed
+	age(t, r, 10*time.Minute)
+	if _, err := r.Verify(old); err == nil {
+		t.Error("verified a token of a retired key")
+	}
+	if _, err := r.Verify(current); err != nil {
+		t.Errorf("verify with the current key: %v", err)
+	}
+	if kids := jwksKeyIDs(r.JWKS()); kids[oldKid] {
+		t.Error("the JWKS still lists the retired key")
+	}
+}
+
+func TestKeyRingRejectsUnknownKeys(t *testing.T) {
+	r, err := NewKeyRing(AlgRS256, 0, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := GenerateKey(AlgRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signToken(other, NewClaims("u1", "ada@example.com", "s1", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Verify(token); err == nil {
+		t.Error("verified a token with an unknown kid")
+	}
+
+	// A known kid does not help a token signed by another key
+	other.ID = tokenKeyID(t, signTest(t, r))
+	if token, err = signToken(other, NewClaims("u1", "ada@example.com", "s1", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Verify(token); err == nil {
+		t.Error("verified a token signed by another key under a known kid")
+	}
+}
+
+func TestKeyRingPersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := NewKeyRing(AlgEdDSA, time.Hour, 10*time.Minute, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signTest(t, r)
+	kid := tokenKeyID(t, token)
+
+	path := filepath.Join(dir, kid+".pem")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A restarted issuer keeps its key and schedule
+	restarted, err := NewKeyRing(AlgEdDSA, time.Hour, 10*time.Minute, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.Verify(token); err != nil {
+		t.Fatalf("verify after a restart: %v", err)
+	}
+	if got := tokenKeyID(t, signTest(t, restarted)); got != kid {
+		t.Errorf("signed with %s after a restart, want %s", got, kid)
+	}
+
+	loaded, err := loadKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mu.RLock()
+	want := *r.keys[0]
+	r.mu.RUnlock()
+	if len(loaded) != 1 || loaded[0].Algorithm != AlgEdDSA ||
+		!loaded[0].NotAfter.Equal(want.NotAfter.Truncate(time.Second)) ||
+		!loaded[0].ExpiresAt.Equal(want.ExpiresAt.Truncate(time.Second)) {
+		t.Errorf("loaded keys = %+v, want the schedule of %+v", loaded, want)
+	}
+
+	// Retired keys are deleted
+	age(t, r, 75*time.Minute)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the retired key file was kept: %v", err)
+	}
+}
+
+func TestLoadKeysRejectsMalformedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewKeyRing(AlgES256, 0, 0, dir); err == nil {
+		t.Error("loaded a malformed key file")
+	}
+}
+
+func TestHMACKeyRing(t *testing.T) {
+	r := NewHMACKeyRing("secret")
+
+	token := signTest(t, r)
+	if kid := tokenKeyID(t, token); kid != "" {
+		t.Errorf("kid = %q, want none", kid)
+	}
+	if _, err := r.Verify(token); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if _, err := NewHMACKeyRing("other").Verify(token); err == nil {
+		t.Error("verified a token signed with another secret")
+	}
+	if keys := r.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS = %+v, want the secret unpublished", keys)
+	}
+}
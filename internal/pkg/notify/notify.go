@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages to users out of band, for example by email.
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// LogNotifier writes messages to the standard logger. It is meant for local
+// runs where no mail server is available.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Send(msg Message) error {
+	log.Printf("notify: to=%s subject=%q body=%q", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileNotifier appends messages to a file as JSON lines, so local runs and
+// scripts can pick up tokens that would normally be emailed.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Send(msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{msg, time.Now()})
+}
+
+// New returns the notifier selected by kind, either "file" or "log".
+func New(kind, path string) Notifier {
+	if kind == "file" {
+		return NewFileNotifier(path)
+	}
+	return NewLogNotifier()
+}
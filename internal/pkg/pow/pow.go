@@ -0,0 +1,42 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+)
+
+// MaxNonceLength is the longest nonce Verify accepts.
+const MaxNonceLength = 64
+
+// Verify reports whether the SHA-256 digest of challenge, a colon and nonce
+// starts with at least difficulty zero bits.
+func Verify(challenge, nonce string, difficulty int) bool {
+	if nonce == "" || len(nonce) > MaxNonceLength {
+		return false
+	}
+
+	return leadingZeros(sha256.Sum256([]byte(challenge+":"+nonce))) >= difficulty
+}
+
+// Solve returns the first decimal nonce solving challenge. Clients solve
+// challenges the same way, each extra bit of difficulty doubles the work.
+func Solve(challenge string, difficulty int) string {
+	for n := uint64(0); ; n++ {
+		nonce := strconv.FormatUint(n, 10)
+		if Verify(challenge, nonce, difficulty) {
+			return nonce
+		}
+	}
+}
+
+func leadingZeros(digest [sha256.Size]byte) int {
+	zeros := 0
+	for _, b := range digest {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
@@ -0,0 +1,85 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestLeadingZeros(t *testing.T) {
+	tests := []struct {
+		prefix []byte
+		want   int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x7f}, 1},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0xff}, 8},
+		{[]byte{0x00, 0x00, 0x10}, 19},
+	}
+
+	for _, tt := range tests {
+		var digest [sha256.Size]byte
+		copy(digest[:], tt.prefix)
+		// Bits after the first one set do not count
+		digest[len(digest)-1] = 0xff
+
+		if got := leadingZeros(digest); got != tt.want {
+			t.Errorf("leadingZeros(%x...) = %d, want %d", tt.prefix, got, tt.want)
+		}
+	}
+
+	if got := leadingZeros([sha256.Size]byte{}); got != 8*sha256.Size {
+		t.Errorf("leadingZeros of a zero digest = %d, want %d", got, 8*sha256.Size)
+	}
+}
+
+func TestSolveSatisfiesVerify(t *testing.T) {
+	for _, difficulty := range []int{0, 1, 8, 12, 16} {
+		nonce := Solve("challenge", difficulty)
+
+		if !Verify("challenge", nonce, difficulty) {
+			t.Errorf("difficulty %d: nonce %s does not verify", difficulty, nonce)
+		}
+
+		digest := sha256.Sum256([]byte("challenge:" + nonce))
+		if zeros := leadingZeros(digest); zeros < difficulty {
+			t.Errorf("difficulty %d: digest has %d leading zero bits", difficulty, zeros)
+		}
+	}
+}
+
+func TestVerifyDifficulty(t *testing.T) {
+	nonce := Solve("challenge", 12)
+	zeros := leadingZeros(sha256.Sum256([]byte("challenge:" + nonce)))
+
+	// An answer is good for its own and any lower difficulty, not more
+	for difficulty := 0; difficulty <= zeros; difficulty++ {
+		if !Verify("challenge", nonce, difficulty) {
+			t.Errorf("nonce rejected at difficulty %d of %d", difficulty, zeros)
+		}
+	}
+	if Verify("challenge", nonce, zeros+1) {
+		t.Errorf("nonce accepted above its %d leading zero bits", zeros)
+	}
+}
+
+func TestVerifyBindsChallenge(t *testing.T) {
+	nonce := Solve("first", 16)
+
+	if Verify("second", nonce, 16) {
+		t.Error("an answer to one challenge solved another")
+	}
+}
+
+func TestVerifyRejectsMalformedNonce(t *testing.T) {
+	if Verify("challenge", "", 0) {
+		t.Error("accepted an empty nonce")
+	}
+	if Verify("challenge", strings.Repeat("1", MaxNonceLength+1), 0) {
+		t.Error("accepted a nonce longer than MaxNonceLength")
+	}
+	if !Verify("challenge", strings.Repeat("1", MaxNonceLength), 0) {
+		t.Error("rejected a nonce of MaxNonceLength")
+	}
+}
@@ -0,0 +1,171 @@
+package ratelimit
+
+import "time"
+
+// algorithm counts attempts on the state of a key. step counts an attempt
+// made at now and reports whether it was allowed. Shared stores run the same
+// step in a script on their server, so concurrent attempts are counted one
+// at a time. result describes the state after a step and returns when the
+// state can be forgotten.
+type algorithm struct {
+	name   string
+	step   func(state *State, now time.Time, limit int, window time.Duration) bool
+	result func(state *State, allowed bool, now time.Time, limit int, window time.Duration) (Result, time.Time)
+}
+
+var (
+	fixedWindow   = algorithm{FixedWindow, fixedWindowStep, fixedWindowResult}
+	slidingLog    = algorithm{SlidingLog, slidingLogStep, slidingLogResult}
+	slidingWindow = algorithm{SlidingWindow, slidingWindowStep, slidingWindowResult}
+	tokenBucket   = algorithm{TokenBucket, tokenBucketStep, tokenBucketResult}
+)
+
+// count runs step on state and returns the result.
+func (a algorithm) count(state *State, now time.Time, limit int, window time.Duration) (Result, time.Time) {
+	allowed := a.step(state, now, limit, window)
+	return a.result(state, allowed, now, limit, window)
+}
+
+func fixedWindowStep(state *State, now time.Time, limit int, window time.Duration) bool {
+	// A window ends when its reset time is reached, as RetryAfter tells
+	if state.Start.IsZero() || now.Sub(state.Start) >= window {
+		state.Start = now
+		state.Count = 0
+	}
+
+	if state.Count >= limit {
+		return false
+	}
+
+	state.Count++
+	return true
+}
+
+func fixedWindowResult(state *State, allowed bool, now time.Time, limit int, window time.Duration) (Result, time.Time) {
+	reset := state.Start.Add(window)
+	if !allowed {
+		return Result{ResetAt: reset, RetryAfter: reset.Sub(now)}, reset
+	}
+
+	return Result{Allowed: true, Remaining: limit - state.Count, ResetAt: reset}, reset
+}
+
+func slidingLogStep(state *State, now time.Time, limit int, window time.Duration) bool {
+	// Forget the attempts that slid out of the window
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(state.Hits) && !state.Hits[i].After(cutoff) {
+		i++
+	}
+	state.Hits = state.Hits[i:]
+
+	if len(state.Hits) >= limit {
+		return false
+	}
+
+	state.Hits = append(state.Hits, now)
+	return true
+}
+
+func slidingLogResult(state *State, allowed bool, now time.Time, limit int, window time.Duration) (Result, time.Time) {
+	reset := state.Hits[len(state.Hits)-1].Add(window)
+	if !allowed {
+		return Result{ResetAt: reset, RetryAfter: state.Hits[0].Add(window).Sub(now)}, reset
+	}
+
+	return Result{Allowed: true, Remaining: limit - len(state.Hits), ResetAt: reset}, reset
+}
+
+// slidingWindowStart returns the start of the aligned window now is in, and
+// the weight of the previous window's count: the share of it still inside
+// the sliding window.
+func slidingWindowStart(now time.Time, window time.Duration) (time.Time, float64) {
+	start := now.Truncate(window)
+	return start, 1 - float64(now.Sub(start))/float64(window)
+}
+
+func slidingWindowStep(state *State, now time.Time, limit int, window time.Duration) bool {
+	start, weight := slidingWindowStart(now, window)
+	if !state.Start.Equal(start) {
+		if state.Start.Equal(start.Add(-window)) {
+			state.Previous = state.Count
+		} else {
+			state.Previous = 0
+		}
+		state.Start = start
+		state.Count = 0
+	}
+
+	if float64(state.Previous)*weight+float64(state.Count)+1 > float64(limit) {
+		return false
+	}
+
+	state.Count++
+	return true
+}
+
+func slidingWindowResult(state *State, allowed bool, now time.Time, limit int, window time.Duration) (Result, time.Time) {
+	start, weight := slidingWindowStart(now, window)
+
+	// The current window's attempts count until the end of the next one
+	expiresAt := start.Add(2 * window)
+
+	if !allowed {
+		reset := start.Add(window)
+		if state.Count > 0 {
+			reset = expiresAt
+		}
+
+		// Wait until enough of the previous window slid out, or for the
+		// next window when the current one is full on its own
+		retryAt := start.Add(window)
+		if state.Count < limit && state.Previous > 0 {
+			share := 1 - float64(limit-state.Count-1)/float64(state.Previous)
+			retryAt = start.Add(time.Duration(share * float64(window)))
+		}
+
+		return Result{ResetAt: reset, RetryAfter: max(retryAt.Sub(now), 0)}, expiresAt
+	}
+
+	// What was used before this attempt
+	used := float64(state.Previous)*weight + float64(state.Count-1)
+	return Result{Allowed: true, Remaining: int(float64(limit) - used - 1), ResetAt: expiresAt}, expiresAt
+}
+
+// tokenInterval returns how often the token bucket gets a token back, in
+// whole milliseconds as shared stores keep times.
+func tokenInterval(limit int, window time.Duration) time.Duration {
+	return max((window / time.Duration(limit)).Truncate(time.Millisecond), time.Millisecond)
+}
+
+// tokenBucketStep is the generic cell rate algorithm. Instead of a token
+// count it keeps the time the bucket is full again, which every attempt
+// moves a refill interval further.
+func tokenBucketStep(state *State, now time.Time, limit int, window time.Duration) bool {
+	full := state.FullAt
+	if full.Before(now) {
+		full = now
+	}
+
+	next := full.Add(tokenInterval(limit, window))
+	if next.Sub(now) > window {
+		return false
+	}
+
+	state.FullAt = next
+	return true
+}
+
+func tokenBucketResult(state *State, allowed bool, now time.Time, limit int, window time.Duration) (Result, time.Time) {
+	interval := tokenInterval(limit, window)
+
+	if !allowed {
+		// The bucket is not full, or the attempt had been allowed
+		full := state.FullAt
+		next := full.Add(interval)
+		return Result{ResetAt: full, RetryAfter: next.Add(-window).Sub(now)}, full
+	}
+
+	next := state.FullAt
+	return Result{Allowed: true, Remaining: int((window - next.Sub(now)) / interval), ResetAt: next}, next
+}
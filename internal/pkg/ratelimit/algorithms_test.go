@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// step is an attempt made offset after the start of a test and its
+// expected result. Reset is relative to the start as well.
+type step struct {
+	offset     time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+	reset      time.Duration
+}
+
+// runSteps counts the attempts of steps with count in every store. The
+// steps start at a whole hour in the future so windows are aligned and the
+// stores do not expire the state in real time.
+func runSteps(t *testing.T, count algorithm, limit int, window time.Duration, steps []step) {
+	t.Helper()
+
+	redis := newRedisServer(t, "")
+	mongo, _ := newMongoStore(t)
+	stores := []struct {
+		name  string
+		store Store
+	}{
+		{"memory", NewMemoryStore()},
+		{"redis", NewRedisStore(NewRedisClient(redis.Addr(), ""))},
+		{"mongo", mongo},
+	}
+
+	start := time.Now().Add(2 * time.Hour).Truncate(time.Hour)
+
+	for _, st := range stores {
+		t.Run(st.name, func(t *testing.T) {
+			for i, s := range steps {
+				now := start.Add(s.offset)
+				state, allowed, err := st.store.Count("key", count, now, limit, window)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, _ := count.result(&state, allowed, now, limit, window)
+
+				if result.Allowed != s.allowed {
+					t.Fatalf("step %d at %v: allowed = %v, want %v", i, s.offset, result.Allowed, s.allowed)
+				}
+				if result.Remaining != s.remaining {
+					t.Errorf("step %d at %v: remaining = %d, want %d", i, s.offset, result.Remaining, s.remaining)
+				}
+				if result.RetryAfter != s.retryAfter {
+					t.Errorf("step %d at %v: retry after = %v, want %v", i, s.offset, result.RetryAfter, s.retryAfter)
+				}
+				if reset := result.ResetAt.Sub(start); reset != s.reset {
+					t.Errorf("step %d at %v: reset = %v, want %v", i, s.offset, reset, s.reset)
+				}
+			}
+		})
+	}
+}
+
+func TestFixedWindow(t *testing.T) {
+	runSteps(t, fixedWindow, 2, time.Minute, []step{
+		{0, true, 1, 0, time.Minute},
+		{10 * time.Second, true, 0, 0, time.Minute},
+		{20 * time.Second, false, 0, 40 * time.Second, time.Minute},
+		{59 * time.Second, false, 0, time.Second, time.Minute},
+		// The next window starts exactly when the denied caller was told
+		// to retry
+		{time.Minute, true, 1, 0, 2 * time.Minute},
+		{time.Minute + time.Second, true, 0, 0, 2 * time.Minute},
+		{time.Minute + 2*time.Second, false, 0, 58 * time.Second, 2 * time.Minute},
+		// A window starts with the first attempt after a pause
+		{5 * time.Minute, true, 1, 0, 6 * time.Minute},
+	})
+}
+
+func TestSlidingLog(t *testing.T) {
+	runSteps(t, slidingLog, 2, time.Minute, []step{
+		{0, true, 1, 0, time.Minute},
+		{10 * time.Second, true, 0, 0, time.Minute + 10*time.Second},
+		// The oldest attempt slides out a window after it was made
+		{20 * time.Second, false, 0, 40 * time.Second, time.Minute + 10*time.Second},
+		{59 * time.Second, false, 0, time.Second, time.Minute + 10*time.Second},
+		{time.Minute, true, 0, 0, 2 * time.Minute},
+		{time.Minute + 5*time.Second, false, 0, 5 * time.Second, 2 * time.Minute},
+		{time.Minute + 10*time.Second, true, 0, 0, 2*time.Minute + 10*time.Second},
+		// Every attempt slid out after a pause
+		{5 * time.Minute, true, 1, 0, 6 * time.Minute},
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	runSteps(t, slidingWindow, 4, time.Minute, []step{
+		{0, true, 3, 0, 2 * time.Minute},
+		{time.Second, true, 2, 0, 2 * time.Minute},
+		{2 * time.Second, true, 1, 0, 2 * time.Minute},
+		{3 * time.Second, true, 0, 0, 2 * time.Minute},
+		// Full on its own, so only the next window helps
+		{30 * time.Second, false, 0, 30 * time.Second, 2 * time.Minute},
+		// The previous window still counts in full at its end, and a
+		// quarter of it has to slide out for the next attempt
+		{time.Minute, false, 0, 15 * time.Second, 2 * time.Minute},
+		{time.Minute + 15*time.Second, true, 0, 0, 3 * time.Minute},
+		// 4 * 44/60 + 1 attempts are counted, half of the previous window
+		// has to slide out
+		{time.Minute + 16*time.Second, false, 0, 14 * time.Second, 3 * time.Minute},
+		{time.Minute + 30*time.Second, true, 0, 0, 3 * time.Minute},
+		// A window after an idle one starts empty
+		{5 * time.Minute, true, 3, 0, 7 * time.Minute},
+	})
+}
+
+func TestTokenBucket(t *testing.T) {
+	// A token is refilled every 30 seconds
+	runSteps(t, tokenBucket, 2, time.Minute, []step{
+		{0, true, 1, 0, 30 * time.Second},
+		{0, true, 0, 0, time.Minute},
+		{0, false, 0, 30 * time.Second, time.Minute},
+		{29 * time.Second, false, 0, time.Second, time.Minute},
+		{30 * time.Second, true, 0, 0, 90 * time.Second},
+		{31 * time.Second, false, 0, 29 * time.Second, 90 * time.Second},
+		// A full bucket after a pause, tokens do not pile up beyond it
+		{5 * time.Minute, true, 1, 0, 5*time.Minute + 30*time.Second},
+		{5 * time.Minute, true, 0, 0, 6 * time.Minute},
+		{5 * time.Minute, false, 0, 30 * time.Second, 6 * time.Minute},
+	})
+}
+
+func TestAlgorithmExpiry(t *testing.T) {
+	start := time.Now().Truncate(time.Hour)
+
+	// The state is kept as long as it affects the next attempt
+	tests := []struct {
+		name  string
+		count algorithm
+		want  time.Duration
+	}{
+		{"fixed window", fixedWindow, time.Minute},
+		{"sliding log", slidingLog, time.Minute},
+		{"sliding window", slidingWindow, 2 * time.Minute},
+		{"token bucket", tokenBucket, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		var state State
+		_, expiresAt := tt.count.count(&state, start, 2, time.Minute)
+		if got := expiresAt.Sub(start); got != tt.want {
+			t.Errorf("%s: expires after %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
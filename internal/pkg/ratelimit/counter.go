@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Counter counts events per key, such as failed logins, within a window
+// starting with the first event. It keeps its counts in a store like the
+// limiters do, as a fixed window without a limit.
+type Counter struct {
+	store  Store
+	name   string
+	window time.Duration
+}
+
+func NewCounter(name string, window time.Duration, store Store) *Counter {
+	return &Counter{
+		store:  store,
+		name:   name,
+		window: window,
+	}
+}
+
+// Add counts an event for key and returns the number of events in its
+// window.
+func (c *Counter) Add(key string) (int, error) {
+	now := time.Now().Truncate(time.Millisecond)
+
+	state, _, err := c.store.Count(c.name+":"+key, fixedWindow, now, math.MaxInt32, c.window)
+	if err != nil {
+		return 0, err
+	}
+
+	return state.Count, nil
+}
+
+// Count returns the number of events counted for key in its window.
+func (c *Counter) Count(key string) (int, error) {
+	state, err := c.store.Get(c.name + ":" + key)
+	if err != nil {
+		return 0, err
+	}
+
+	if state.Start.IsZero() || time.Since(state.Start) >= c.window {
+		return 0, nil
+	}
+
+	return state.Count, nil
+}
+
+// Reset forgets the events counted for key.
+func (c *Counter) Reset(key string) error {
+	return c.store.Delete(c.name + ":" + key)
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyHeader is the metadata key clients send their API key in.
+const APIKeyHeader = "x-api-key"
+
+// Response headers reporting the quota of a call. Reset and retry-after are
+// in seconds from now.
+const (
+	HeaderLimit      = "x-ratelimit-limit"
+	HeaderRemaining  = "x-ratelimit-remaining"
+	HeaderReset      = "x-ratelimit-reset"
+	HeaderRetryAfter = "retry-after"
+)
+
+// QuotaInterceptor enforces the quotas of unary methods. It must run after
+// the authentication interceptor to count calls for users.
+func QuotaInterceptor(quotas *Quotas) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		setHeader := func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		}
+
+		if err := quotas.check(ctx, info.FullMethod, setHeader); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// QuotaStreamInterceptor is QuotaInterceptor for streaming methods. A
+// stream is counted as one call.
+func QuotaStreamInterceptor(quotas *Quotas) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := quotas.check(ss.Context(), info.FullMethod, ss.SetHeader); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// check counts a call to method against its quota and reports the quota in
+// the response headers. Calls the store could not count for contention are
+// denied, and when the store cannot be reached the call is let through.
+func (q *Quotas) check(ctx context.Context, method string, setHeader func(metadata.MD) error) error {
+	ql := q.lookup(method)
+	if ql == nil || ql.limiter == nil {
+		return nil
+	}
+
+	key, err := q.callerKey(ctx, ql.quota.Key)
+	if err != nil {
+		return err
+	}
+
+	result, err := ql.limiter.Allow(key)
+	if err != nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		return nil
+	}
+
+	md := metadata.Pairs(
+		HeaderLimit, strconv.Itoa(result.Limit),
+		HeaderRemaining, strconv.Itoa(result.Remaining),
+		HeaderReset, seconds(time.Until(result.ResetAt)),
+	)
+	if !result.Allowed {
+		md.Set(HeaderRetryAfter, seconds(result.RetryAfter))
+	}
+
+	if err := setHeader(md); err != nil {
+		log.Printf("Failed to set rate limit headers: %v", err)
+	}
+
+	if !result.Allowed {
+		return (&LimitError{
+			Message:    "rate limit exceeded, please try again later",
+			RetryAfter: result.RetryAfter,
+		}).GRPCStatus().Err()
+	}
+
+	return nil
+}
+
+// callerKey returns what calls are counted for under the key of a quota.
+// API keys are only counted for once they are found among the listed ones,
+// so made up keys cannot each get a fresh quota. Calls without one are
+// counted for their user, or else their IP address. API keys are hashed so
+// they are not kept in the store.
+func (q *Quotas) callerKey(ctx context.Context, key string) (string, error) {
+	switch key {
+	case KeyAPIKey:
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(APIKeyHeader); len(values) > 0 && values[0] != "" {
+			sum := sha256.Sum256([]byte(values[0]))
+			digest := hex.EncodeToString(sum[:])
+			if !q.validAPIKey(digest) {
+				return "", status.Error(codes.Unauthenticated, "invalid API key")
+			}
+			return "api_key:" + digest, nil
+		}
+		fallthrough
+	case KeyUser:
+		if userID, ok := ctx.Value("userID").(string); ok && userID != "" {
+			return "user:" + userID, nil
+		}
+	}
+
+	return "ip:" + peerIP(ctx), nil
+}
+
+// peerIP returns the IP address a call came from.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(max(d, 0).Seconds())), 10)
+}
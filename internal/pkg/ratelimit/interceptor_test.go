@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func writeQuotas(t *testing.T, content string) *Quotas {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ratelimit.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	quotas, err := NewQuotas(path, FixedWindow, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return quotas
+}
+
+func digest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func callContext(apiKey, userID string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4000},
+	})
+	if apiKey != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(APIKeyHeader, apiKey))
+	}
+	if userID != "" {
+		ctx = context.WithValue(ctx, "userID", userID)
+	}
+	return ctx
+}
+
+func TestCallerKey(t *testing.T) {
+	quotas := writeQuotas(t, `{"quotas": {}, "api_keys": ["`+digest("known")+`"]}`)
+
+	tests := []struct {
+		name     string
+		key      string
+		apiKey   string
+		userID   string
+		want     string
+		wantCode codes.Code
+	}{
+		{"listed API key", KeyAPIKey, "known", "u1", "api_key:" + digest("known"), codes.OK},
+		{"unknown API key", KeyAPIKey, "made-up", "u1", "", codes.Unauthenticated},
+		{"no API key falls back to user", KeyAPIKey, "", "u1", "user:u1", codes.OK},
+		{"no API key nor user falls back to IP", KeyAPIKey, "", "", "ip:192.0.2.1", codes.OK},
+		{"user", KeyUser, "made-up", "u1", "user:u1", codes.OK},
+		{"user falls back to IP", KeyUser, "", "", "ip:192.0.2.1", codes.OK},
+		{"IP ignores API key", KeyIP, "made-up", "u1", "ip:192.0.2.1", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := quotas.callerKey(callContext(tt.apiKey, tt.userID), tt.key)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v (err %v)", code, tt.wantCode, err)
+			}
+			if got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRejectsUnknownAPIKeys(t *testing.T) {
+	quotas := writeQuotas(t, `{
+		"quotas": {"*": {"limit": 1, "window": "1m", "key": "api_key"}},
+		"api_keys": ["`+digest("known")+`"]
+	}`)
+	noHeader := func(metadata.MD) error { return nil }
+
+	// Each made up key is rejected rather than given a quota of its own
+	for _, key := range []string{"a", "b", "c"} {
+		err := quotas.check(callContext(key, ""), "/test.Service/Call", noHeader)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("key %q: err = %v, want Unauthenticated", key, err)
+		}
+	}
+
+	if err := quotas.check(callContext("known", ""), "/test.Service/Call", noHeader); err != nil {
+		t.Fatalf("listed key: %v", err)
+	}
+	err := quotas.check(callContext("known", ""), "/test.Service/Call", noHeader)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("listed key over quota: err = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestInvalidAPIKeyDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.json")
+	if err := os.WriteFile(path, []byte(`{"quotas": {}, "api_keys": ["plain-key"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewQuotas(path, FixedWindow, NewMemoryStore()); err == nil {
+		t.Error("accepted an API key that is not a SHA-256 digest")
+	}
+}
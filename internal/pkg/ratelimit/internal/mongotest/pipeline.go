@@ -0,0 +1,467 @@
+package mongotest
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// missing is the value of a field path that does not exist. It differs from
+// null: a $set stage does not add fields evaluating to it.
+type missingValue struct{}
+
+var missing = missingValue{}
+
+// applyPipeline returns a copy of doc with the $set, $addFields and $unset
+// stages of pipeline applied.
+func applyPipeline(doc bson.D, pipeline bson.A) (bson.D, error) {
+	for _, value := range pipeline {
+		stage, ok := value.(bson.D)
+		if !ok || len(stage) != 1 {
+			return nil, fmt.Errorf("invalid pipeline stage %v", value)
+		}
+
+		switch stage[0].Key {
+		case "$set", "$addFields":
+			fields, ok := stage[0].Value.(bson.D)
+			if !ok {
+				return nil, fmt.Errorf("%s needs a document", stage[0].Key)
+			}
+
+			// Every expression sees the document as it was before the stage
+			values := make([]interface{}, len(fields))
+			for i, field := range fields {
+				v, err := evaluate(field.Value, doc, nil)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = v
+			}
+
+			for i, field := range fields {
+				if values[i] != missing {
+					doc = setPath(doc, strings.Split(field.Key, "."), values[i])
+				}
+			}
+		case "$unset":
+			var paths []string
+			switch v := stage[0].Value.(type) {
+			case string:
+				paths = []string{v}
+			case bson.A:
+				for _, path := range v {
+					paths = append(paths, fmt.Sprint(path))
+				}
+			}
+
+			for _, path := range paths {
+				doc = unsetPath(doc, strings.Split(path, "."))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported pipeline stage %s", stage[0].Key)
+		}
+	}
+
+	return doc, nil
+}
+
+// setPath returns a copy of doc with the field at path set to value,
+// replacing whatever is on the way that is not a document.
+func setPath(doc bson.D, path []string, value interface{}) bson.D {
+	doc = append(bson.D{}, doc...)
+	if len(path) == 1 {
+		return setField(doc, path[0], value)
+	}
+
+	inner, _ := lookup(doc, path[0]).(bson.D)
+	return setField(doc, path[0], setPath(inner, path[1:], value))
+}
+
+func unsetPath(doc bson.D, path []string) bson.D {
+	updated := bson.D{}
+	for _, e := range doc {
+		if e.Key != path[0] {
+			updated = append(updated, e)
+			continue
+		}
+
+		if inner, ok := e.Value.(bson.D); ok && len(path) > 1 {
+			updated = append(updated, bson.E{Key: e.Key, Value: unsetPath(inner, path[1:])})
+		}
+	}
+	return updated
+}
+
+// evaluate returns the value of an aggregation expression on doc, with vars
+// holding the variables bound by operators such as $filter.
+func evaluate(expr interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case string:
+		if name, ok := strings.CutPrefix(e, "$$"); ok {
+			if v, ok := vars[name]; ok {
+				return v, nil
+			}
+			return nil, fmt.Errorf("undefined variable %s", e)
+		}
+		if path, ok := strings.CutPrefix(e, "$"); ok {
+			return fieldPath(doc, strings.Split(path, ".")), nil
+		}
+		return e, nil
+	case bson.A:
+		values := make(bson.A, len(e))
+		for i, item := range e {
+			v, err := evaluate(item, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			if v == missing {
+				v = nil
+			}
+			values[i] = v
+		}
+		return values, nil
+	case bson.D:
+		if len(e) == 1 && strings.HasPrefix(e[0].Key, "$") {
+			return operator(e[0].Key, e[0].Value, doc, vars)
+		}
+
+		object := bson.D{}
+		for _, field := range e {
+			v, err := evaluate(field.Value, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			if v != missing {
+				object = append(object, bson.E{Key: field.Key, Value: v})
+			}
+		}
+		return object, nil
+	default:
+		return expr, nil
+	}
+}
+
+func fieldPath(doc bson.D, path []string) interface{} {
+	for i, key := range path {
+		found := false
+		for _, e := range doc {
+			if e.Key == key {
+				if i == len(path)-1 {
+					return e.Value
+				}
+				doc, found = e.Value.(bson.D)
+				break
+			}
+		}
+		if !found {
+			return missing
+		}
+	}
+	return missing
+}
+
+func operator(name string, arg interface{}, doc bson.D, vars map[string]interface{}) (interface{}, error) {
+	if name == "$literal" {
+		return arg, nil
+	}
+
+	if name == "$filter" {
+		spec, _ := arg.(bson.D)
+		input, err := evaluate(lookup(spec, "input"), doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := input.(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("$filter needs an array input, got %v", input)
+		}
+
+		as := "this"
+		if v, ok := lookup(spec, "as").(string); ok {
+			as = v
+		}
+
+		kept := bson.A{}
+		for _, item := range items {
+			scope := map[string]interface{}{as: item}
+			for k, v := range vars {
+				if k != as {
+					scope[k] = v
+				}
+			}
+
+			keep, err := evaluate(lookup(spec, "cond"), doc, scope)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(keep) {
+				kept = append(kept, item)
+			}
+		}
+		return kept, nil
+	}
+
+	if name == "$cond" {
+		// Only the branch taken is evaluated
+		branches, ok := arg.(bson.A)
+		if !ok || len(branches) != 3 {
+			return nil, fmt.Errorf("$cond needs 3 arguments")
+		}
+
+		condition, err := evaluate(branches[0], doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(condition) {
+			return evaluate(branches[1], doc, vars)
+		}
+		return evaluate(branches[2], doc, vars)
+	}
+
+	// The other operators take their evaluated arguments, a single one
+	// does not need to be in an array
+	list, ok := arg.(bson.A)
+	if !ok {
+		list = bson.A{arg}
+	}
+	value, err := evaluate(list, doc, vars)
+	if err != nil {
+		return nil, err
+	}
+	args := value.(bson.A)
+
+	switch name {
+	case "$ifNull":
+		for _, a := range args {
+			if a != nil && a != missing {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "$eq", "$gt", "$gte", "$lt", "$lte":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s needs 2 arguments", name)
+		}
+		c := compare(args[0], args[1])
+		switch name {
+		case "$eq":
+			return c == 0, nil
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	case "$add":
+		return add(args)
+	case "$subtract":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("$subtract needs 2 arguments")
+		}
+		return subtract(args[0], args[1])
+	case "$multiply":
+		product := interface{}(int64(1))
+		for _, a := range args {
+			if isNull(a) {
+				return nil, nil
+			}
+			if !isNumber(a) {
+				return nil, fmt.Errorf("$multiply only supports numbers, got %T", a)
+			}
+			product = arithmetic(product, a, func(x, y float64) float64 { return x * y }, func(x, y int64) int64 { return x * y })
+		}
+		return product, nil
+	case "$max":
+		var best interface{}
+		for _, a := range args {
+			if isNull(a) {
+				continue
+			}
+			if best == nil || compare(a, best) > 0 {
+				best = a
+			}
+		}
+		return best, nil
+	case "$size":
+		items, ok := args[0].(bson.A)
+		if len(args) != 1 || !ok {
+			return nil, fmt.Errorf("$size needs an array")
+		}
+		return int32(len(items)), nil
+	case "$concatArrays":
+		joined := bson.A{}
+		for _, a := range args {
+			items, ok := a.(bson.A)
+			if !ok {
+				return nil, fmt.Errorf("$concatArrays only supports arrays, got %T", a)
+			}
+			joined = append(joined, items...)
+		}
+		return joined, nil
+	case "$arrayElemAt":
+		items, ok := args[0].(bson.A)
+		if len(args) != 2 || !ok || !isNumber(args[1]) {
+			return nil, fmt.Errorf("$arrayElemAt needs an array and an index")
+		}
+		i := int(toInt64(args[1]))
+		if i < 0 {
+			i += len(items)
+		}
+		if i < 0 || i >= len(items) {
+			return missing, nil
+		}
+		return items[i], nil
+	default:
+		return nil, fmt.Errorf("unsupported expression operator %s", name)
+	}
+}
+
+func add(args bson.A) (interface{}, error) {
+	var sum interface{} = int64(0)
+	var date *primitive.DateTime
+
+	for _, a := range args {
+		switch v := a.(type) {
+		case primitive.DateTime:
+			if date != nil {
+				return nil, fmt.Errorf("$add only supports one date")
+			}
+			date = &v
+		default:
+			if isNull(a) {
+				return nil, nil
+			}
+			if !isNumber(a) {
+				return nil, fmt.Errorf("$add only supports numbers and dates, got %T", a)
+			}
+			sum = arithmetic(sum, a, func(x, y float64) float64 { return x + y }, func(x, y int64) int64 { return x + y })
+		}
+	}
+
+	if date != nil {
+		return primitive.DateTime(int64(*date) + toInt64(sum)), nil
+	}
+	return sum, nil
+}
+
+func subtract(a, b interface{}) (interface{}, error) {
+	if isNull(a) || isNull(b) {
+		return nil, nil
+	}
+
+	dateA, aIsDate := a.(primitive.DateTime)
+	dateB, bIsDate := b.(primitive.DateTime)
+	switch {
+	case aIsDate && bIsDate:
+		return int64(dateA) - int64(dateB), nil
+	case aIsDate && isNumber(b):
+		return primitive.DateTime(int64(dateA) - toInt64(b)), nil
+	case isNumber(a) && isNumber(b):
+		return arithmetic(a, b, func(x, y float64) float64 { return x - y }, func(x, y int64) int64 { return x - y }), nil
+	}
+
+	return nil, fmt.Errorf("cannot subtract %T from %T", b, a)
+}
+
+// arithmetic applies an operator to two numbers, in floating point when
+// either of them is a double.
+func arithmetic(a, b interface{}, floats func(x, y float64) float64, ints func(x, y int64) int64) interface{} {
+	_, aFloat := a.(float64)
+	_, bFloat := b.(float64)
+	if aFloat || bFloat {
+		return floats(toFloat64(a), toFloat64(b))
+	}
+	return ints(toInt64(a), toInt64(b))
+}
+
+func toFloat64(v interface{}) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return float64(toInt64(v))
+}
+
+func isNull(v interface{}) bool {
+	return v == nil || v == missing
+}
+
+func truthy(v interface{}) bool {
+	switch b := v.(type) {
+	case nil, missingValue:
+		return false
+	case bool:
+		return b
+	}
+	if isNumber(v) {
+		return toFloat64(v) != 0
+	}
+	return true
+}
+
+// compare orders values like the server does: by type first, then by value.
+func compare(a, b interface{}) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+	if rankA != rankB {
+		return rankA - rankB
+	}
+
+	switch {
+	case isNumber(a):
+		return compareFloats(toFloat64(a), toFloat64(b))
+	case rankA == typeRank(primitive.DateTime(0)):
+		return compareFloats(float64(a.(primitive.DateTime)), float64(b.(primitive.DateTime)))
+	}
+
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		if x == b.(bool) {
+			return 0
+		}
+		if x {
+			return 1
+		}
+		return -1
+	}
+
+	if equal(a, b) {
+		return 0
+	}
+	return 1
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, missingValue:
+		return 1
+	case int, int32, int64, float64:
+		return 2
+	case string:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	}
+	return 10
+}
@@ -0,0 +1,520 @@
+// Package mongotest runs an in-process stand-in for a MongoDB server. It
+// speaks OP_MSG and handles enough commands for the rate limit store:
+// hello, ping, createIndexes, find, insert, delete, and findAndModify with
+// an update pipeline of $set, $addFields and $unset stages, all filtering
+// on equal top-level fields. Clients must request a
+// server API version so the driver does not fall back to legacy opcodes.
+package mongotest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	opMsg          = 2013
+	checksumFlag   = 1
+	duplicateKey   = 11000
+	commandFailure = 1
+)
+
+// Server is a MongoDB stand-in listening on a local port.
+type Server struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	collections map[string][]bson.D
+	conns       map[net.Conn]bool
+	fail        func(command string) string
+}
+
+// NewServer starts a server with no documents.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:    listener,
+		collections: make(map[string][]bson.D),
+		conns:       make(map[net.Conn]bool),
+	}
+
+	go s.serve()
+	return s, nil
+}
+
+// URI returns the connection string of the server.
+func (s *Server) URI() string {
+	return "mongodb://" + s.listener.Addr().String() + "/?directConnection=true"
+}
+
+// Close stops the server and closes every connection.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// FailWith makes the server fail the commands named by their first field,
+// such as "find", with the message fail returns, unless it returns "".
+// Messages starting with E11000 are duplicate key errors. A nil fail stops
+// failing.
+func (s *Server) FailWith(fail func(command string) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fail = fail
+}
+
+// Insert adds doc to collection, which is named "db.collection". Its values
+// are stored as their BSON types, like those of inserted documents.
+func (s *Server) Insert(collection string, doc bson.D) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var stored bson.D
+	if err := bson.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insert(collection, stored)
+}
+
+// Find returns the documents of collection matching filter.
+func (s *Server) Find(collection string, filter bson.D) []bson.D {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []bson.D
+	for _, doc := range s.collections[collection] {
+		if matches(doc, filter) {
+			found = append(found, doc)
+		}
+	}
+	return found
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		requestID, command, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+
+		reply, err := bson.Marshal(s.execute(command))
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(appendMessage(requestID, reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) execute(command bson.D) bson.D {
+	if len(command) == 0 {
+		return failure(commandFailure, "empty command")
+	}
+
+	name := command[0].Key
+	collection := fmt.Sprintf("%v.%v", lookup(command, "$db"), command[0].Value)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail != nil {
+		if msg := s.fail(name); msg != "" {
+			if strings.HasPrefix(msg, "E11000") {
+				return failure(duplicateKey, msg)
+			}
+			return failure(commandFailure, msg)
+		}
+	}
+
+	switch name {
+	case "hello", "isMaster", "ismaster":
+		return bson.D{
+			{Key: "helloOk", Value: true},
+			{Key: "isWritablePrimary", Value: true},
+			{Key: "ismaster", Value: true},
+			{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)},
+			{Key: "maxMessageSizeBytes", Value: int32(48000000)},
+			{Key: "maxWriteBatchSize", Value: int32(100000)},
+			{Key: "minWireVersion", Value: int32(0)},
+			{Key: "maxWireVersion", Value: int32(21)},
+			{Key: "ok", Value: 1.0},
+		}
+	case "ping", "createIndexes", "endSessions":
+		return bson.D{{Key: "ok", Value: 1.0}}
+	case "find":
+		return s.find(collection, command)
+	case "insert":
+		return s.insertCommand(collection, command)
+	case "delete":
+		return s.deleteCommand(collection, command)
+	case "findAndModify":
+		return s.findAndModify(collection, command)
+	default:
+		return failure(59, "no such command: '"+name+"'")
+	}
+}
+
+func (s *Server) find(collection string, command bson.D) bson.D {
+	filter, _ := lookup(command, "filter").(bson.D)
+	limit := toInt64(lookup(command, "limit"))
+
+	batch := bson.A{}
+	for _, doc := range s.collections[collection] {
+		if limit > 0 && int64(len(batch)) >= limit {
+			break
+		}
+		if matches(doc, filter) {
+			batch = append(batch, doc)
+		}
+	}
+
+	return bson.D{
+		{Key: "cursor", Value: bson.D{
+			{Key: "firstBatch", Value: batch},
+			{Key: "id", Value: int64(0)},
+			{Key: "ns", Value: collection},
+		}},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+func (s *Server) insertCommand(collection string, command bson.D) bson.D {
+	docs, _ := lookup(command, "documents").(bson.A)
+
+	n := 0
+	writeErrors := bson.A{}
+	for i, value := range docs {
+		doc, _ := value.(bson.D)
+		if err := s.insert(collection, doc); err != nil {
+			writeErrors = append(writeErrors, bson.D{
+				{Key: "index", Value: int32(i)},
+				{Key: "code", Value: int32(duplicateKey)},
+				{Key: "errmsg", Value: err.Error()},
+			})
+			continue
+		}
+		n++
+	}
+
+	reply := bson.D{{Key: "n", Value: int32(n)}}
+	if len(writeErrors) > 0 {
+		reply = append(reply, bson.E{Key: "writeErrors", Value: writeErrors})
+	}
+	return append(reply, bson.E{Key: "ok", Value: 1.0})
+}
+
+func (s *Server) insert(collection string, doc bson.D) error {
+	id := lookup(doc, "_id")
+	for _, existing := range s.collections[collection] {
+		if equal(lookup(existing, "_id"), id) {
+			return fmt.Errorf("E11000 duplicate key error collection: %s dup key: { _id: %v }", collection, id)
+		}
+	}
+
+	s.collections[collection] = append(s.collections[collection], doc)
+	return nil
+}
+
+func (s *Server) deleteCommand(collection string, command bson.D) bson.D {
+	deletes, _ := lookup(command, "deletes").(bson.A)
+
+	n := 0
+	for _, value := range deletes {
+		statement, _ := value.(bson.D)
+		filter, _ := lookup(statement, "q").(bson.D)
+
+		docs := s.collections[collection]
+		for i, doc := range docs {
+			if matches(doc, filter) {
+				s.collections[collection] = append(docs[:i:i], docs[i+1:]...)
+				n++
+				break
+			}
+		}
+	}
+
+	return bson.D{
+		{Key: "n", Value: int32(n)},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+// findAndModify updates the first document matching the query, or inserts
+// one made of the query's fields on upsert, and returns it as it was, or as
+// it is with new.
+func (s *Server) findAndModify(collection string, command bson.D) bson.D {
+	query, _ := lookup(command, "query").(bson.D)
+	upsert, _ := lookup(command, "upsert").(bool)
+	returnNew, _ := lookup(command, "new").(bool)
+
+	index := -1
+	var doc bson.D
+	for i, existing := range s.collections[collection] {
+		if matches(existing, query) {
+			index, doc = i, existing
+			break
+		}
+	}
+
+	if index < 0 {
+		if !upsert {
+			return bson.D{{Key: "value", Value: nil}, {Key: "ok", Value: 1.0}}
+		}
+		doc = append(bson.D{}, query...)
+	}
+
+	pipeline, ok := lookup(command, "update").(bson.A)
+	if !ok {
+		return failure(commandFailure, "findAndModify needs an update pipeline")
+	}
+	updated, err := applyPipeline(doc, pipeline)
+	if err != nil {
+		return failure(commandFailure, err.Error())
+	}
+
+	lastError := bson.D{{Key: "n", Value: int32(1)}, {Key: "updatedExisting", Value: index >= 0}}
+	if index >= 0 {
+		s.collections[collection][index] = updated
+	} else {
+		if err := s.insert(collection, updated); err != nil {
+			return failure(duplicateKey, err.Error())
+		}
+		lastError = append(lastError, bson.E{Key: "upserted", Value: lookup(updated, "_id")})
+	}
+
+	value := doc
+	if returnNew {
+		value = updated
+	} else if index < 0 {
+		value = nil
+	}
+
+	return bson.D{
+		{Key: "lastErrorObject", Value: lastError},
+		{Key: "value", Value: value},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+func setField(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+// matches reports whether the top-level fields of doc equal those of filter.
+func matches(doc, filter bson.D) bool {
+	for _, field := range filter {
+		if !equal(lookup(doc, field.Key), field.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	if isNumber(a) && isNumber(b) {
+		return toInt64(a) == toInt64(b)
+	}
+
+	typeA, dataA, errA := bson.MarshalValue(a)
+	typeB, dataB, errB := bson.MarshalValue(b)
+	return errA == nil && errB == nil && typeA == typeB && string(dataA) == string(dataB)
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, float64:
+		return true
+	}
+	return false
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func lookup(doc bson.D, key string) interface{} {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func failure(code int32, msg string) bson.D {
+	return bson.D{
+		{Key: "ok", Value: 0.0},
+		{Key: "errmsg", Value: msg},
+		{Key: "code", Value: code},
+	}
+}
+
+// readMessage reads an OP_MSG and returns its request ID and its command,
+// with the documents of sequence sections added as arrays.
+func readMessage(r io.Reader) (int32, bson.D, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int32(binary.LittleEndian.Uint32(header))
+	requestID := int32(binary.LittleEndian.Uint32(header[4:]))
+	opCode := int32(binary.LittleEndian.Uint32(header[12:]))
+	if length < 21 || length > 48000000 {
+		return 0, nil, errors.New("invalid message length")
+	}
+
+	body := make([]byte, length-16)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	if opCode != opMsg {
+		return 0, nil, fmt.Errorf("unsupported opcode %d", opCode)
+	}
+
+	flags := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	if flags&checksumFlag != 0 {
+		body = body[:len(body)-4]
+	}
+
+	var command bson.D
+	var sequences bson.D
+	for len(body) > 0 {
+		kind := body[0]
+		body = body[1:]
+
+		switch kind {
+		case 0:
+			size, err := documentSize(body)
+			if err != nil {
+				return 0, nil, err
+			}
+			if err := bson.Unmarshal(body[:size], &command); err != nil {
+				return 0, nil, err
+			}
+			body = body[size:]
+		case 1:
+			size, err := documentSize(body)
+			if err != nil {
+				return 0, nil, err
+			}
+			section := body[4:size]
+			body = body[size:]
+
+			end := strings.IndexByte(string(section), 0)
+			if end < 0 {
+				return 0, nil, errors.New("unterminated section identifier")
+			}
+			identifier := string(section[:end])
+			section = section[end+1:]
+
+			docs := bson.A{}
+			for len(section) > 0 {
+				docSize, err := documentSize(section)
+				if err != nil {
+					return 0, nil, err
+				}
+				var doc bson.D
+				if err := bson.Unmarshal(section[:docSize], &doc); err != nil {
+					return 0, nil, err
+				}
+				docs = append(docs, doc)
+				section = section[docSize:]
+			}
+			sequences = append(sequences, bson.E{Key: identifier, Value: docs})
+		default:
+			return 0, nil, fmt.Errorf("unknown section kind %d", kind)
+		}
+	}
+
+	return requestID, append(command, sequences...), nil
+}
+
+// documentSize returns the length prefix of data, checking it fits.
+func documentSize(data []byte) (int, error) {
+	if len(data) < 4 {
+		return 0, errors.New("truncated section")
+	}
+
+	size := int(binary.LittleEndian.Uint32(data))
+	if size < 5 || size > len(data) {
+		return 0, errors.New("invalid section size")
+	}
+	return size, nil
+}
+
+// appendMessage encodes an OP_MSG replying to requestID with doc.
+func appendMessage(requestID int32, doc []byte) []byte {
+	length := 16 + 4 + 1 + len(doc)
+
+	msg := make([]byte, 0, length)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(length))
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(requestID))
+	msg = binary.LittleEndian.AppendUint32(msg, opMsg)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = append(msg, 0)
+	return append(msg, doc...)
+}
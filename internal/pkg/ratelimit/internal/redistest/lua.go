@@ -0,0 +1,1253 @@
+package redistest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The scripts EVAL runs are interpreted in a subset of Lua 5.1: local
+// variables, assignments, if, numeric for, return, calls, tables, and the
+// arithmetic, comparison, logical, length and concatenation operators.
+// Scripts see KEYS, ARGV, redis.call, redis.error_reply, cjson.encode,
+// cjson.decode, tonumber, math.max and math.floor. Like Redis, scripts may
+// not create global variables.
+
+// Values are nil, bool, float64, string, *luaTable or luaFunc.
+type luaFunc func(args []interface{}) (interface{}, error)
+
+type luaTable struct {
+	fields map[interface{}]interface{}
+}
+
+func newTable() *luaTable {
+	return &luaTable{fields: make(map[interface{}]interface{})}
+}
+
+func (t *luaTable) get(key interface{}) interface{} {
+	return t.fields[key]
+}
+
+func (t *luaTable) set(key, value interface{}) {
+	if value == nil {
+		delete(t.fields, key)
+		return
+	}
+	t.fields[key] = value
+}
+
+// length is the border of the table: the last index of its sequence.
+func (t *luaTable) length() int {
+	n := 0
+	for t.fields[float64(n+1)] != nil {
+		n++
+	}
+	return n
+}
+
+// luaError is an error raised by a script, such as by a failing redis.call.
+type luaError struct {
+	msg string
+}
+
+func (e *luaError) Error() string {
+	return e.msg
+}
+
+// Tokens
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	line  int
+}
+
+var keywords = map[string]bool{
+	"and": true, "do": true, "else": true, "elseif": true, "end": true, "false": true,
+	"for": true, "if": true, "local": true, "nil": true, "not": true, "or": true,
+	"return": true, "then": true, "true": true,
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' ||
+				src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			word := src[start:i]
+			kind := tokenName
+			if keywords[word] {
+				kind = tokenSymbol
+			}
+			tokens = append(tokens, token{kind: kind, text: word, line: line})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' ||
+				src[i] == 'e' || src[i] == 'E' || (src[i] == '-' || src[i] == '+') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				i++
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed number %s", line, src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], value: n, line: line})
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[i])
+					}
+				} else {
+					b.WriteByte(src[i])
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("line %d: unfinished string", line)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: b.String(), value: b.String(), line: line})
+		default:
+			symbol := ""
+			for _, s := range []string{"==", "~=", "<=", ">=", "..", "+", "-", "*", "/", "%", "#",
+				"<", ">", "=", "(", ")", "{", "}", "[", "]", ";", ",", "."} {
+				if strings.HasPrefix(src[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, fmt.Errorf("line %d: unexpected symbol %q", line, c)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol, line: line})
+			i += len(symbol)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, text: "<eof>", line: line}), nil
+}
+
+// Syntax tree
+
+type (
+	expr interface{}
+	stat interface{}
+
+	constExpr struct{ value interface{} }
+	nameExpr  struct{ name string }
+	indexExpr struct{ object, key expr }
+	callExpr  struct {
+		fn   expr
+		args []expr
+	}
+	binaryExpr struct {
+		op          string
+		left, right expr
+	}
+	unaryExpr struct {
+		op      string
+		operand expr
+	}
+	tableExpr struct {
+		keys   []expr // nil for positional fields
+		values []expr
+	}
+
+	localStat struct {
+		names  []string
+		values []expr
+	}
+	assignStat struct {
+		targets []expr
+		values  []expr
+	}
+	callStat struct{ call *callExpr }
+	ifStat   struct {
+		conds  []expr
+		blocks [][]stat
+		orElse []stat
+	}
+	forStat struct {
+		name             string
+		start, end, step expr
+		body             []stat
+	}
+	returnStat struct{ values []expr }
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(symbol string) bool {
+	t := p.peek()
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (p *parser) accept(symbol string) bool {
+	if p.is(symbol) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(symbol string) error {
+	if !p.accept(symbol) {
+		t := p.peek()
+		return fmt.Errorf("line %d: '%s' expected near '%s'", t.line, symbol, t.text)
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.next()
+	if t.kind != tokenName {
+		return "", fmt.Errorf("line %d: name expected near '%s'", t.line, t.text)
+	}
+	return t.text, nil
+}
+
+// block parses statements until one of the closing keywords.
+func (p *parser) block() ([]stat, error) {
+	var stats []stat
+	for {
+		if p.peek().kind == tokenEOF || p.is("end") || p.is("else") || p.is("elseif") {
+			return stats, nil
+		}
+
+		if p.accept("return") {
+			var values []expr
+			if !p.is("end") && !p.is("else") && !p.is("elseif") && p.peek().kind != tokenEOF && !p.is(";") {
+				var err error
+				if values, err = p.exprList(); err != nil {
+					return nil, err
+				}
+			}
+			p.accept(";")
+			return append(stats, &returnStat{values: values}), nil
+		}
+
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			stats = append(stats, s)
+		}
+	}
+}
+
+func (p *parser) statement() (stat, error) {
+	switch {
+	case p.accept(";"):
+		return nil, nil
+	case p.accept("local"):
+		s := &localStat{}
+		for {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			s.names = append(s.names, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if p.accept("=") {
+			values, err := p.exprList()
+			if err != nil {
+				return nil, err
+			}
+			s.values = values
+		}
+		return s, nil
+	case p.accept("if"):
+		s := &ifStat{}
+		for {
+			cond, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("then"); err != nil {
+				return nil, err
+			}
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			s.conds = append(s.conds, cond)
+			s.blocks = append(s.blocks, body)
+			if !p.accept("elseif") {
+				break
+			}
+		}
+		if p.accept("else") {
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			s.orElse = body
+		}
+		return s, p.expect("end")
+	case p.accept("for"):
+		s := &forStat{step: &constExpr{value: 1.0}}
+		var err error
+		if s.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if s.start, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if s.end, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if s.step, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		if s.body, err = p.block(); err != nil {
+			return nil, err
+		}
+		return s, p.expect("end")
+	}
+
+	// An assignment or a call
+	target, err := p.suffixed()
+	if err != nil {
+		return nil, err
+	}
+
+	if call, ok := target.(*callExpr); ok && !p.is("=") && !p.is(",") {
+		return &callStat{call: call}, nil
+	}
+
+	s := &assignStat{targets: []expr{target}}
+	for p.accept(",") {
+		target, err := p.suffixed()
+		if err != nil {
+			return nil, err
+		}
+		s.targets = append(s.targets, target)
+	}
+	for _, target := range s.targets {
+		switch target.(type) {
+		case *nameExpr, *indexExpr:
+		default:
+			return nil, fmt.Errorf("line %d: syntax error near '%s'", p.peek().line, p.peek().text)
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	if s.values, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	var list []expr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.accept(",") {
+			return list, nil
+		}
+	}
+}
+
+// Binary operators by precedence, loosest first
+var precedence = map[string]int{
+	"or": 1, "and": 2,
+	"<": 3, ">": 3, "<=": 3, ">=": 3, "~=": 3, "==": 3,
+	"..": 4,
+	"+":  5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// unaryPrecedence binds tighter than every binary operator
+const unaryPrecedence = 7
+
+func (p *parser) expr() (expr, error) {
+	return p.binary(1)
+}
+
+func (p *parser) binary(minPrecedence int) (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokenSymbol || !ok || prec < minPrecedence {
+			return left, nil
+		}
+		p.next()
+
+		// Concatenation is right associative
+		next := prec + 1
+		if t.text == ".." {
+			next = prec
+		}
+		right, err := p.binary(next)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	for _, op := range []string{"not", "-", "#"} {
+		if p.accept(op) {
+			operand, err := p.binary(unaryPrecedence)
+			if err != nil {
+				return nil, err
+			}
+			return &unaryExpr{op: op, operand: operand}, nil
+		}
+	}
+	return p.simple()
+}
+
+func (p *parser) simple() (expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber || t.kind == tokenString:
+		p.next()
+		return &constExpr{value: t.value}, nil
+	case p.accept("nil"):
+		return &constExpr{}, nil
+	case p.accept("true"):
+		return &constExpr{value: true}, nil
+	case p.accept("false"):
+		return &constExpr{value: false}, nil
+	case p.is("{"):
+		return p.table()
+	}
+	return p.suffixed()
+}
+
+// suffixed parses a name or parenthesized expression followed by field
+// accesses, indexes and calls.
+func (p *parser) suffixed() (expr, error) {
+	var e expr
+	switch {
+	case p.accept("("):
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		e = inner
+	case p.peek().kind == tokenName:
+		e = &nameExpr{name: p.next().text}
+	default:
+		t := p.peek()
+		return nil, fmt.Errorf("line %d: unexpected symbol near '%s'", t.line, t.text)
+	}
+
+	for {
+		switch {
+		case p.accept("."):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{object: e, key: &constExpr{value: name}}
+		case p.accept("["):
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{object: e, key: key}
+		case p.accept("("):
+			call := &callExpr{fn: e}
+			if !p.is(")") {
+				args, err := p.exprList()
+				if err != nil {
+					return nil, err
+				}
+				call.args = args
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			e = call
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *parser) table() (expr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	t := &tableExpr{}
+	for !p.accept("}") {
+		var key expr
+		switch {
+		case p.accept("["):
+			k, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			key = k
+		case p.peek().kind == tokenName && p.tokens[p.pos+1].text == "=":
+			key = &constExpr{value: p.next().text}
+			p.next()
+		}
+
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		t.keys = append(t.keys, key)
+		t.values = append(t.values, value)
+
+		if !p.accept(",") && !p.accept(";") {
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return t, nil
+}
+
+// Evaluation
+
+// scope holds the local variables of a block.
+type scope struct {
+	vars   map[string]*interface{}
+	parent *scope
+}
+
+func (s *scope) lookup(name string) *interface{} {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *scope) declare(name string, value interface{}) {
+	s.vars[name] = &value
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]*interface{}), parent: parent}
+}
+
+type interpreter struct {
+	globals map[string]interface{}
+}
+
+// returned carries the values of a return statement up to the script.
+type returned struct {
+	values []interface{}
+}
+
+// runScript runs src with the given globals and returns the first value it
+// returns.
+func runScript(src string, globals map[string]interface{}) (interface{}, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("line %d: '<eof>' expected near '%s'", t.line, t.text)
+	}
+
+	in := &interpreter{globals: globals}
+	ret, err := in.block(body, newScope(nil))
+	if err != nil || ret == nil || len(ret.values) == 0 {
+		return nil, err
+	}
+	return ret.values[0], nil
+}
+
+func (in *interpreter) block(stats []stat, parent *scope) (*returned, error) {
+	sc := newScope(parent)
+
+	for _, s := range stats {
+		switch s := s.(type) {
+		case *localStat:
+			values, err := in.exprs(s.values, sc)
+			if err != nil {
+				return nil, err
+			}
+			for i, name := range s.names {
+				var v interface{}
+				if i < len(values) {
+					v = values[i]
+				}
+				sc.declare(name, v)
+			}
+		case *assignStat:
+			values, err := in.exprs(s.values, sc)
+			if err != nil {
+				return nil, err
+			}
+			for i, target := range s.targets {
+				var v interface{}
+				if i < len(values) {
+					v = values[i]
+				}
+				if err := in.assign(target, v, sc); err != nil {
+					return nil, err
+				}
+			}
+		case *callStat:
+			if _, err := in.eval(s.call, sc); err != nil {
+				return nil, err
+			}
+		case *ifStat:
+			body := s.orElse
+			for i, cond := range s.conds {
+				v, err := in.eval(cond, sc)
+				if err != nil {
+					return nil, err
+				}
+				if truthy(v) {
+					body = s.blocks[i]
+					break
+				}
+			}
+			if ret, err := in.block(body, sc); ret != nil || err != nil {
+				return ret, err
+			}
+		case *forStat:
+			var bounds [3]float64
+			for i, e := range []expr{s.start, s.end, s.step} {
+				v, err := in.eval(e, sc)
+				if err != nil {
+					return nil, err
+				}
+				n, ok := toNumber(v)
+				if !ok {
+					return nil, errors.New("'for' initial value, limit and step must be numbers")
+				}
+				bounds[i] = n
+			}
+
+			for i := bounds[0]; bounds[2] > 0 && i <= bounds[1] || bounds[2] < 0 && i >= bounds[1]; i += bounds[2] {
+				loop := newScope(sc)
+				loop.declare(s.name, i)
+				if ret, err := in.block(s.body, loop); ret != nil || err != nil {
+					return ret, err
+				}
+			}
+		case *returnStat:
+			values, err := in.exprs(s.values, sc)
+			if err != nil {
+				return nil, err
+			}
+			return &returned{values: values}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (in *interpreter) assign(target expr, value interface{}, sc *scope) error {
+	switch t := target.(type) {
+	case *nameExpr:
+		if v := sc.lookup(t.name); v != nil {
+			*v = value
+			return nil
+		}
+		return fmt.Errorf("Script attempted to create global variable '%s'", t.name)
+	case *indexExpr:
+		object, err := in.eval(t.object, sc)
+		if err != nil {
+			return err
+		}
+		table, ok := object.(*luaTable)
+		if !ok {
+			return fmt.Errorf("attempt to index a %s value", typeName(object))
+		}
+		key, err := in.eval(t.key, sc)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return errors.New("table index is nil")
+		}
+		table.set(key, value)
+		return nil
+	}
+	return errors.New("cannot assign")
+}
+
+func (in *interpreter) exprs(list []expr, sc *scope) ([]interface{}, error) {
+	values := make([]interface{}, len(list))
+	for i, e := range list {
+		v, err := in.eval(e, sc)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (in *interpreter) eval(e expr, sc *scope) (interface{}, error) {
+	switch e := e.(type) {
+	case *constExpr:
+		return e.value, nil
+	case *nameExpr:
+		if v := sc.lookup(e.name); v != nil {
+			return *v, nil
+		}
+		return in.globals[e.name], nil
+	case *indexExpr:
+		object, err := in.eval(e.object, sc)
+		if err != nil {
+			return nil, err
+		}
+		table, ok := object.(*luaTable)
+		if !ok {
+			return nil, fmt.Errorf("attempt to index a %s value", typeName(object))
+		}
+		key, err := in.eval(e.key, sc)
+		if err != nil {
+			return nil, err
+		}
+		return table.get(key), nil
+	case *callExpr:
+		fn, err := in.eval(e.fn, sc)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := fn.(luaFunc)
+		if !ok {
+			return nil, fmt.Errorf("attempt to call a %s value", typeName(fn))
+		}
+		args, err := in.exprs(e.args, sc)
+		if err != nil {
+			return nil, err
+		}
+		return f(args)
+	case *tableExpr:
+		t := newTable()
+		n := 0
+		for i, value := range e.values {
+			v, err := in.eval(value, sc)
+			if err != nil {
+				return nil, err
+			}
+			if e.keys[i] == nil {
+				n++
+				t.set(float64(n), v)
+				continue
+			}
+			key, err := in.eval(e.keys[i], sc)
+			if err != nil {
+				return nil, err
+			}
+			t.set(key, v)
+		}
+		return t, nil
+	case *unaryExpr:
+		v, err := in.eval(e.operand, sc)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case "not":
+			return !truthy(v), nil
+		case "-":
+			n, ok := toNumber(v)
+			if !ok {
+				return nil, fmt.Errorf("attempt to perform arithmetic on a %s value", typeName(v))
+			}
+			return -n, nil
+		default:
+			switch v := v.(type) {
+			case string:
+				return float64(len(v)), nil
+			case *luaTable:
+				return float64(v.length()), nil
+			}
+			return nil, fmt.Errorf("attempt to get length of a %s value", typeName(v))
+		}
+	case *binaryExpr:
+		left, err := in.eval(e.left, sc)
+		if err != nil {
+			return nil, err
+		}
+
+		// The logical operators short-circuit
+		switch e.op {
+		case "and":
+			if !truthy(left) {
+				return left, nil
+			}
+			return in.eval(e.right, sc)
+		case "or":
+			if truthy(left) {
+				return left, nil
+			}
+			return in.eval(e.right, sc)
+		}
+
+		right, err := in.eval(e.right, sc)
+		if err != nil {
+			return nil, err
+		}
+		return binary(e.op, left, right)
+	}
+
+	return nil, fmt.Errorf("cannot evaluate %T", e)
+}
+
+func binary(op string, left, right interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return left == right, nil
+	case "~=":
+		return left != right, nil
+	case "..":
+		l, lok := toText(left)
+		r, rok := toText(right)
+		if !lok || !rok {
+			return nil, fmt.Errorf("attempt to concatenate a %s value", typeName(left))
+		}
+		return l + r, nil
+	case "<", "<=", ">", ">=":
+		var c int
+		ln, lok := left.(float64)
+		rn, rok := right.(float64)
+		ls, lsok := left.(string)
+		rs, rsok := right.(string)
+		switch {
+		case lok && rok:
+			c = compareNumbers(ln, rn)
+		case lsok && rsok:
+			c = strings.Compare(ls, rs)
+		default:
+			return nil, fmt.Errorf("attempt to compare %s with %s", typeName(left), typeName(right))
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+
+	l, lok := toNumber(left)
+	r, rok := toNumber(right)
+	if !lok || !rok {
+		bad := left
+		if lok {
+			bad = right
+		}
+		return nil, fmt.Errorf("attempt to perform arithmetic on a %s value", typeName(bad))
+	}
+
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "%":
+		return l - math.Floor(l/r)*r, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+// toNumber converts numbers and, like Lua, strings holding numbers.
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func toText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return formatNumber(v), true
+	}
+	return "", false
+}
+
+// formatNumber formats n like Lua's %.14g.
+func formatNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1e14 {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(n, 'g', 14, 64)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *luaTable:
+		return "table"
+	case luaFunc:
+		return "function"
+	}
+	return "userdata"
+}
+
+// Libraries
+
+func libraryTable(fields map[string]interface{}) *luaTable {
+	t := newTable()
+	for k, v := range fields {
+		t.set(k, v)
+	}
+	return t
+}
+
+// scriptGlobals returns the globals of a script run with keys and args,
+// where call runs a Redis command.
+func scriptGlobals(keys, args []string, call func(args []string) (interface{}, error)) map[string]interface{} {
+	strings := func(values []string) *luaTable {
+		t := newTable()
+		for i, v := range values {
+			t.set(float64(i+1), v)
+		}
+		return t
+	}
+
+	return map[string]interface{}{
+		"KEYS": strings(keys),
+		"ARGV": strings(args),
+		"redis": libraryTable(map[string]interface{}{
+			"call": luaFunc(func(values []interface{}) (interface{}, error) {
+				command := make([]string, len(values))
+				for i, v := range values {
+					text, ok := toText(v)
+					if !ok {
+						return nil, &luaError{"Lua redis() command arguments must be strings or integers"}
+					}
+					command[i] = text
+				}
+				if len(command) == 0 {
+					return nil, &luaError{"Please specify at least one argument for redis.call()"}
+				}
+
+				reply, err := call(command)
+				if err != nil {
+					return nil, &luaError{err.Error()}
+				}
+				return toLua(reply), nil
+			}),
+			"error_reply": luaFunc(func(values []interface{}) (interface{}, error) {
+				msg, _ := toText(first(values))
+				return libraryTable(map[string]interface{}{"err": msg}), nil
+			}),
+		}),
+		"cjson": libraryTable(map[string]interface{}{
+			"encode": luaFunc(func(values []interface{}) (interface{}, error) {
+				return encodeJSON(first(values))
+			}),
+			"decode": luaFunc(func(values []interface{}) (interface{}, error) {
+				text, ok := first(values).(string)
+				if !ok {
+					return nil, &luaError{"bad argument #1 to 'decode' (string expected)"}
+				}
+				var v interface{}
+				if err := json.Unmarshal([]byte(text), &v); err != nil {
+					return nil, &luaError{"Expected value but found invalid token"}
+				}
+				return fromJSON(v), nil
+			}),
+		}),
+		"math": libraryTable(map[string]interface{}{
+			"max": luaFunc(func(values []interface{}) (interface{}, error) {
+				return numbers(values, math.Max)
+			}),
+			"floor": luaFunc(func(values []interface{}) (interface{}, error) {
+				n, ok := toNumber(first(values))
+				if !ok {
+					return nil, &luaError{"bad argument #1 to 'floor' (number expected)"}
+				}
+				return math.Floor(n), nil
+			}),
+		}),
+		"tonumber": luaFunc(func(values []interface{}) (interface{}, error) {
+			if n, ok := toNumber(first(values)); ok {
+				return n, nil
+			}
+			return nil, nil
+		}),
+	}
+}
+
+func first(values []interface{}) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+func numbers(values []interface{}, combine func(a, b float64) float64) (interface{}, error) {
+	if len(values) == 0 {
+		return nil, &luaError{"bad argument #1 (number expected, got no value)"}
+	}
+
+	result := math.NaN()
+	for i, v := range values {
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, &luaError{fmt.Sprintf("bad argument #%d (number expected, got %s)", i+1, typeName(v))}
+		}
+		if i == 0 {
+			result = n
+		} else {
+			result = combine(result, n)
+		}
+	}
+	return result, nil
+}
+
+// toLua converts a command reply to a Lua value, as Redis does.
+func toLua(reply interface{}) interface{} {
+	switch r := reply.(type) {
+	case nil:
+		return false
+	case int64:
+		return float64(r)
+	case status:
+		return libraryTable(map[string]interface{}{"ok": string(r)})
+	case []interface{}:
+		t := newTable()
+		for i, item := range r {
+			t.set(float64(i+1), toLua(item))
+		}
+		return t
+	}
+	return reply
+}
+
+// fromLua converts what a script returns to a reply, as Redis does.
+// Numbers are truncated to integers, and arrays end at their first nil.
+func fromLua(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return nil, nil
+	case float64:
+		return int64(v), nil
+	case *luaTable:
+		if msg, ok := v.get("err").(string); ok {
+			return nil, errors.New(msg)
+		}
+		if msg, ok := v.get("ok").(string); ok {
+			return status(msg), nil
+		}
+
+		items := []interface{}{}
+		for i := 1; v.get(float64(i)) != nil; i++ {
+			item, err := fromLua(v.get(float64(i)))
+			if err != nil {
+				item = err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return v, nil
+}
+
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		t := newTable()
+		for k, item := range v {
+			t.set(k, fromJSON(item))
+		}
+		return t
+	case []interface{}:
+		t := newTable()
+		for i, item := range v {
+			t.set(float64(i+1), fromJSON(item))
+		}
+		return t
+	}
+	return v
+}
+
+// encodeJSON encodes like cjson: tables with only the keys 1 to n are
+// arrays, other tables objects, and an empty table is an empty object.
+// Numbers are formatted with 14 significant digits.
+func encodeJSON(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return formatNumber(v), nil
+	case string:
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	case *luaTable:
+		n := v.length()
+		if n > 0 && n == len(v.fields) {
+			items := make([]string, n)
+			for i := range items {
+				item, err := encodeJSON(v.get(float64(i + 1)))
+				if err != nil {
+					return "", err
+				}
+				items[i] = item
+			}
+			return "[" + strings.Join(items, ",") + "]", nil
+		}
+
+		var keys []string
+		for k := range v.fields {
+			key, ok := k.(string)
+			if !ok {
+				return "", &luaError{"Cannot serialise table: excessively sparse array"}
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]string, len(keys))
+		for i, k := range keys {
+			name, _ := json.Marshal(k)
+			item, err := encodeJSON(v.get(k))
+			if err != nil {
+				return "", err
+			}
+			fields[i] = string(name) + ":" + item
+		}
+		return "{" + strings.Join(fields, ",") + "}", nil
+	}
+	return "", &luaError{"Cannot serialise " + typeName(v)}
+}
@@ -0,0 +1,367 @@
+// Package redistest runs an in-process stand-in for a Redis server. It
+// speaks enough of the protocol for the rate limit store: AUTH, PING, GET,
+// SET with PX, DEL and EVAL, which runs scripts in a subset of Lua.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a Redis stand-in listening on a local port.
+type Server struct {
+	listener net.Listener
+	password string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	conns   map[net.Conn]bool
+	peak    int
+	fail    func(args []string) string
+}
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewServer starts a server requiring password, none when it is empty.
+func NewServer(password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		password: password,
+		entries:  make(map[string]*entry),
+		conns:    make(map[net.Conn]bool),
+	}
+
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address clients connect to.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes every connection.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.CloseConnections()
+}
+
+// CloseConnections drops every open connection, like a server restart.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// PeakConnections returns the most connections that were open at once.
+func (s *Server) PeakConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.peak
+}
+
+// FailWith makes the server reply with the error fail returns for a
+// command, unless it returns "". A nil fail stops failing.
+func (s *Server) FailWith(fail func(args []string) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fail = fail
+}
+
+// Set stores value under key without an expiry.
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(key, value, time.Time{})
+}
+
+// Get returns the value of key and its remaining time to live, zero when
+// it does not expire.
+func (s *Server) Get(key string) (string, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(key)
+	if e == nil {
+		return "", 0, false
+	}
+
+	var ttl time.Duration
+	if !e.expiresAt.IsZero() {
+		ttl = time.Until(e.expiresAt)
+	}
+	return e.value, ttl, true
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.peak = max(s.peak, len(s.conns))
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// session is the state of one connection.
+type session struct {
+	authed bool
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	sess := &session{authed: s.password == ""}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		if _, err := conn.Write(encodeReply(s.execute(sess, args))); err != nil {
+			return
+		}
+	}
+}
+
+// status is a simple string reply, such as OK.
+type status string
+
+// execute runs a command and returns its reply: nil, a status, an int64, a
+// string, a slice of replies or an error.
+func (s *Server) execute(sess *session, args []string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail != nil {
+		if msg := s.fail(args); msg != "" {
+			return errors.New(msg)
+		}
+	}
+
+	if strings.ToUpper(args[0]) == "AUTH" {
+		if len(args) != 2 || args[1] != s.password {
+			return errors.New("WRONGPASS invalid password")
+		}
+		sess.authed = true
+		return status("OK")
+	}
+	if !sess.authed {
+		return errors.New("NOAUTH Authentication required.")
+	}
+
+	if strings.ToUpper(args[0]) == "EVAL" {
+		return s.eval(args)
+	}
+	return s.command(args)
+}
+
+// eval runs a script while holding the lock, so no other command runs
+// before it finished, as on Redis.
+func (s *Server) eval(args []string) interface{} {
+	if len(args) < 3 {
+		return errors.New("ERR wrong number of arguments for 'eval' command")
+	}
+
+	n, err := strconv.Atoi(args[2])
+	if err != nil || n < 0 {
+		return errors.New("ERR value is not an integer or out of range")
+	}
+	if n > len(args)-3 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+
+	keys, argv := args[3:3+n], args[3+n:]
+	value, err := runScript(args[1], scriptGlobals(keys, argv, func(args []string) (interface{}, error) {
+		if strings.ToUpper(args[0]) == "EVAL" {
+			return nil, errors.New("This Redis command is not allowed from script")
+		}
+		reply := s.command(args)
+		if err, ok := reply.(error); ok {
+			return nil, err
+		}
+		return reply, nil
+	}))
+	if err != nil {
+		return errors.New("ERR Error running script: " + err.Error())
+	}
+
+	reply, err := fromLua(value)
+	if err != nil {
+		return err
+	}
+	return reply
+}
+
+func (s *Server) command(args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return status("PONG")
+	case "GET":
+		if len(args) != 2 {
+			return errors.New("ERR wrong number of arguments for 'get' command")
+		}
+		e := s.lookup(args[1])
+		if e == nil {
+			return nil
+		}
+		return e.value
+	case "SET":
+		return s.setCommand(args)
+	case "DEL":
+		var deleted int64
+		for _, key := range args[1:] {
+			if s.lookup(key) != nil {
+				delete(s.entries, key)
+				deleted++
+			}
+		}
+		return deleted
+	default:
+		return errors.New("ERR unknown command '" + args[0] + "'")
+	}
+}
+
+func (s *Server) setCommand(args []string) interface{} {
+	if len(args) != 3 && len(args) != 5 {
+		return errors.New("ERR syntax error")
+	}
+
+	var expiresAt time.Time
+	if len(args) == 5 {
+		if strings.ToUpper(args[3]) != "PX" {
+			return errors.New("ERR syntax error")
+		}
+		ms, err := strconv.ParseInt(args[4], 10, 64)
+		if err != nil || ms <= 0 {
+			return errors.New("ERR invalid expire time in 'set' command")
+		}
+		expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	s.set(args[1], args[2], expiresAt)
+	return status("OK")
+}
+
+func (s *Server) set(key, value string, expiresAt time.Time) {
+	s.entries[key] = &entry{value: value, expiresAt: expiresAt}
+}
+
+// lookup returns the entry of key, removing it once it expired.
+func (s *Server) lookup(key string) *entry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+
+	return e
+}
+
+// encodeReply encodes a reply in the protocol.
+func encodeReply(reply interface{}) []byte {
+	switch r := reply.(type) {
+	case nil:
+		return []byte("$-1\r\n")
+	case status:
+		return []byte("+" + string(r) + "\r\n")
+	case int64:
+		return fmt.Appendf(nil, ":%d\r\n", r)
+	case string:
+		return fmt.Appendf(nil, "$%d\r\n%s\r\n", len(r), r)
+	case error:
+		return []byte("-" + r.Error() + "\r\n")
+	case []interface{}:
+		data := fmt.Appendf(nil, "*%d\r\n", len(r))
+		for _, item := range r {
+			data = append(data, encodeReply(item)...)
+		}
+		return data
+	}
+	return []byte("-ERR unsupported reply\r\n")
+}
+
+// readCommand reads an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, errors.New("expected an array")
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, errors.New("invalid array length")
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 || line[0] != '$' {
+			return nil, errors.New("expected a bulk string")
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errors.New("invalid bulk string length")
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per key in the rateLimits collection.
+// Attempts are counted by one findAndModify with an update pipeline, which
+// the server applies to a document at a time. A TTL index removes the
+// documents once they expire.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// stateDocument is the state of a key and whether its latest attempt was
+// allowed.
+type stateDocument struct {
+	ID        string    `bson:"_id"`
+	State     State     `bson:"state"`
+	Allowed   bool      `bson:"allowed"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	collection := db.Collection("rateLimits")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	return &MongoStore{
+		collection: collection,
+	}
+}
+
+func (s *MongoStore) Count(key string, count algorithm, now time.Time, limit int, window time.Duration) (State, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := countPipeline(count.name, now, limit, window)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	for range updateRetries {
+		var doc stateDocument
+		err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc)
+		if mongo.IsDuplicateKeyError(err) {
+			// Another replica inserted the document first
+			continue
+		}
+		if err != nil {
+			return State{}, false, err
+		}
+
+		return doc.State, doc.Allowed, nil
+	}
+
+	return State{}, false, ErrContended
+}
+
+func (s *MongoStore) Get(key string) (State, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc stateDocument
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+
+	// The TTL monitor only runs every minute
+	if !time.Now().Before(doc.ExpiresAt) {
+		return State{}, nil
+	}
+
+	return doc.State, nil
+}
+
+func (s *MongoStore) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// countPipeline returns the update running the step of the algorithm named
+// name on a state document. It keeps whether the attempt was allowed in the
+// allowed field.
+func countPipeline(name string, now time.Time, limit int, window time.Duration) mongo.Pipeline {
+	windowMillis := window.Milliseconds()
+
+	// A document the TTL monitor has not removed yet is expired all the same
+	pipeline := mongo.Pipeline{
+		mongoSet(bson.M{"state": mongoCond(
+			bson.M{"$gt": bson.A{"$expires_at", now}},
+			"$state",
+			bson.M{"$literal": bson.M{}},
+		)}),
+	}
+
+	// Counts the attempt once the allowed field is set
+	countAllowed := bson.M{"state.count": mongoCond("$allowed", bson.M{"$add": bson.A{"$state.count", 1}}, "$state.count")}
+
+	switch name {
+	case FixedWindow:
+		started := bson.M{"$ifNull": bson.A{"$state.start", time.UnixMilli(0)}}
+		countAllowed["expires_at"] = bson.M{"$add": bson.A{"$state.start", windowMillis}}
+
+		pipeline = append(pipeline,
+			mongoSet(bson.M{"state": mongoCond(
+				bson.M{"$gte": bson.A{bson.M{"$subtract": bson.A{now, started}}, windowMillis}},
+				bson.M{"$literal": bson.M{"start": now, "count": 0}},
+				"$state",
+			)}),
+			mongoSet(bson.M{"allowed": bson.M{"$lt": bson.A{"$state.count", limit}}}),
+			mongoSet(countAllowed),
+		)
+	case SlidingLog:
+		pipeline = append(pipeline,
+			// Forget the attempts that slid out of the window
+			mongoSet(bson.M{"state.hits": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$state.hits", bson.A{}}},
+				"cond":  bson.M{"$gt": bson.A{"$$this", now.Add(-window)}},
+			}}}),
+			mongoSet(bson.M{"allowed": bson.M{"$lt": bson.A{bson.M{"$size": "$state.hits"}, limit}}}),
+			mongoSet(bson.M{"state.hits": mongoCond(
+				"$allowed",
+				bson.M{"$concatArrays": bson.A{"$state.hits", bson.A{now}}},
+				"$state.hits",
+			)}),
+			mongoSet(bson.M{"expires_at": bson.M{"$add": bson.A{
+				bson.M{"$arrayElemAt": bson.A{"$state.hits", -1}}, windowMillis,
+			}}}),
+		)
+	case SlidingWindow:
+		start, weight := slidingWindowStart(now, window)
+		countAllowed["expires_at"] = start.Add(2 * window)
+
+		pipeline = append(pipeline,
+			mongoSet(bson.M{"state": mongoCond(
+				bson.M{"$eq": bson.A{"$state.start", start}},
+				"$state",
+				bson.M{
+					"start": start,
+					"count": 0,
+					"previous": mongoCond(
+						bson.M{"$eq": bson.A{"$state.start", start.Add(-window)}},
+						"$state.count",
+						0,
+					),
+				},
+			)}),
+			mongoSet(bson.M{"allowed": bson.M{"$lte": bson.A{
+				bson.M{"$add": bson.A{
+					bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$state.previous", 0}}, weight}},
+					"$state.count",
+					1,
+				}},
+				limit,
+			}}}),
+			mongoSet(countAllowed),
+		)
+	case TokenBucket:
+		intervalMillis := tokenInterval(limit, window).Milliseconds()
+
+		pipeline = append(pipeline,
+			mongoSet(bson.M{"full": bson.M{"$max": bson.A{bson.M{"$ifNull": bson.A{"$state.full_at", now}}, now}}}),
+			mongoSet(bson.M{"allowed": bson.M{"$lte": bson.A{
+				bson.M{"$subtract": bson.A{bson.M{"$add": bson.A{"$full", intervalMillis}}, now}},
+				windowMillis,
+			}}}),
+			mongoSet(bson.M{"state.full_at": mongoCond(
+				"$allowed",
+				bson.M{"$add": bson.A{"$full", intervalMillis}},
+				"$state.full_at",
+			)}),
+			mongoSet(bson.M{"expires_at": "$state.full_at"}),
+			bson.D{{Key: "$unset", Value: "full"}},
+		)
+	}
+
+	return pipeline
+}
+
+func mongoSet(fields bson.M) bson.D {
+	return bson.D{{Key: "$set", Value: fields}}
+}
+
+func mongoCond(condition, then, otherwise interface{}) bson.M {
+	return bson.M{"$cond": bson.A{condition, then, otherwise}}
+}
@@ -0,0 +1,192 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit/internal/mongotest"
+)
+
+// The collection of the stand-in server the store uses
+const rateLimitsCollection = "test.rateLimits"
+
+func newMongoStore(t *testing.T) (*MongoStore, *mongotest.Server) {
+	t.Helper()
+
+	srv, err := mongotest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(srv.URI()).
+		SetServerAPIOptions(options.ServerAPI(options.ServerAPIVersion1)).
+		SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return NewMongoStore(client.Database("test")), srv
+}
+
+func TestMongoStore(t *testing.T) {
+	store, _ := newMongoStore(t)
+	testStore(t, store)
+}
+
+func TestMongoStoreDocument(t *testing.T) {
+	store, srv := newMongoStore(t)
+
+	for range 3 {
+		countAttempt(t, store, "key")
+	}
+
+	docs := srv.Find(rateLimitsCollection, bson.D{{Key: "_id", Value: "key"}})
+	if len(docs) != 1 {
+		t.Fatalf("found %d documents, want 1", len(docs))
+	}
+
+	var doc stateDocument
+	data, _ := bson.Marshal(docs[0])
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Allowed || doc.State.Count != 3 {
+		t.Errorf("allowed %v with count %d, want true and 3", doc.Allowed, doc.State.Count)
+	}
+	if until := time.Until(doc.ExpiresAt); until <= 0 || until > time.Minute {
+		t.Errorf("expires in %v, want up to a minute", until)
+	}
+}
+
+func TestMongoStoreExpiredDocument(t *testing.T) {
+	store, srv := newMongoStore(t)
+
+	// The TTL monitor has not removed the document yet
+	err := srv.Insert(rateLimitsCollection, bson.D{
+		{Key: "_id", Value: "stale"},
+		{Key: "state", Value: bson.D{
+			{Key: "start", Value: time.Now().Add(-2 * time.Minute)},
+			{Key: "count", Value: 5},
+		}},
+		{Key: "expires_at", Value: time.Now().Add(-time.Second)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := readState(t, store, "stale").Count; count != 0 {
+		t.Errorf("count = %d from an expired document, want 0", count)
+	}
+	if count := countAttempt(t, store, "stale").Count; count != 1 {
+		t.Errorf("count = %d after an expired document, want 1", count)
+	}
+}
+
+func TestMongoStoreConcurrentInsert(t *testing.T) {
+	store, srv := newMongoStore(t)
+
+	// Another replica inserted the document between the upsert's lookup and
+	// its insert, and the retry updates it
+	failures := 0
+	srv.FailWith(func(name string) string {
+		if name == "findAndModify" && failures < updateRetries-1 {
+			failures++
+			return "E11000 duplicate key error"
+		}
+		return ""
+	})
+	if count := countAttempt(t, store, "new").Count; count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+
+	// An attempt that keeps losing is reported as contended, and denied
+	srv.FailWith(func(name string) string {
+		if name == "findAndModify" {
+			return "E11000 duplicate key error"
+		}
+		return ""
+	})
+	if _, _, err := store.Count("new", fixedWindow, time.Now(), 10, time.Minute); !errors.Is(err, ErrContended) {
+		t.Fatalf("err = %v, want ErrContended", err)
+	}
+
+	limiter, err := New(FixedWindow, "test", 10, time.Minute, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := limiter.Allow("new")
+	if err != nil || result.Allowed || result.RetryAfter <= 0 {
+		t.Errorf("contended attempt = %+v, %v, want denied with a retry delay", result, err)
+	}
+}
+
+func TestMongoStoreMalformedDocument(t *testing.T) {
+	store, srv := newMongoStore(t)
+
+	err := srv.Insert(rateLimitsCollection, bson.D{
+		{Key: "_id", Value: "bad"},
+		{Key: "state", Value: "not a document"},
+		{Key: "expires_at", Value: time.Now().Add(time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get("bad"); err == nil {
+		t.Fatal("read a malformed document")
+	}
+}
+
+func TestMongoStoreCommandErrors(t *testing.T) {
+	tests := []struct {
+		command string
+		call    func(store *MongoStore) error
+	}{
+		{"findAndModify", func(store *MongoStore) error {
+			_, _, err := store.Count("key", fixedWindow, time.Now(), 10, time.Minute)
+			return err
+		}},
+		{"find", func(store *MongoStore) error {
+			_, err := store.Get("key")
+			return err
+		}},
+		{"delete", func(store *MongoStore) error {
+			return store.Delete("key")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			store, srv := newMongoStore(t)
+			countAttempt(t, store, "key")
+
+			srv.FailWith(func(name string) string {
+				if name == tt.command {
+					return "injected failure"
+				}
+				return ""
+			})
+
+			if err := tt.call(store); err == nil {
+				t.Fatalf("call succeeded although %s failed", tt.command)
+			}
+
+			srv.FailWith(nil)
+			if err := tt.call(store); err != nil {
+				t.Fatalf("call after the failure: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Who quotas count calls for. Calls without a user or API key are counted
+// for their IP address, and calls with an API key that is not listed in the
+// quotas file are rejected.
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyAPIKey = "api_key"
+)
+
+// Quota limits the calls to the methods it is configured for. A quota
+// without a limit exempts its methods. Without an algorithm the default of
+// the quotas is used.
+type Quota struct {
+	Limit     int    `json:"limit"`
+	Window    string `json:"window"`
+	Key       string `json:"key"`
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// quotaFile maps full method names to their quotas. "/package.Service/*"
+// covers the other methods of a service, and "*" every other method.
+// APIKeys lists the hex SHA-256 digests of the API keys that are accepted.
+type quotaFile struct {
+	Quotas  map[string]Quota `json:"quotas"`
+	APIKeys []string         `json:"api_keys"`
+}
+
+type quotaLimiter struct {
+	quota   Quota
+	limiter Limiter
+}
+
+// Quotas are the per-method quotas of a file. Calls to a method are counted
+// against its own quota, or else the quota of its service or the default
+// one, shared by every method it covers.
+type Quotas struct {
+	path      string
+	algorithm string
+	store     Store
+
+	mu       sync.RWMutex
+	limiters map[string]*quotaLimiter
+	apiKeys  map[string]bool
+	modTime  time.Time
+}
+
+// NewQuotas loads the quotas of the JSON file at path, counting calls in
+// store. Without a path no method is limited.
+func NewQuotas(path, algorithm string, store Store) (*Quotas, error) {
+	q := &Quotas{
+		path:      path,
+		algorithm: algorithm,
+		store:     store,
+		limiters:  make(map[string]*quotaLimiter),
+	}
+
+	if path == "" {
+		return q, nil
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// RunReloader loads the quotas again whenever the file was modified,
+// checking every interval. Invalid files are logged and the previous quotas
+// kept. It never returns.
+func (q *Quotas) RunReloader(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(q.path)
+		if err != nil {
+			log.Printf("Failed to check rate limit quotas: %v", err)
+			continue
+		}
+
+		q.mu.RLock()
+		modified := !info.ModTime().Equal(q.modTime)
+		q.mu.RUnlock()
+		if !modified {
+			continue
+		}
+
+		if err := q.load(); err != nil {
+			log.Printf("Failed to reload rate limit quotas: %v", err)
+			continue
+		}
+
+		log.Printf("Reloaded rate limit quotas from %s", q.path)
+	}
+}
+
+func (q *Quotas) load() error {
+	info, err := os.Stat(q.path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		return err
+	}
+
+	var file quotaFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid rate limit quotas: %w", err)
+	}
+
+	apiKeys := make(map[string]bool, len(file.APIKeys))
+	for _, digest := range file.APIKeys {
+		digest = strings.ToLower(digest)
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("invalid API key digest %q", digest)
+		}
+		apiKeys[digest] = true
+	}
+
+	limiters := make(map[string]*quotaLimiter, len(file.Quotas))
+	for method, quota := range file.Quotas {
+		if method != "*" && !strings.HasPrefix(method, "/") {
+			return fmt.Errorf("invalid rate limit quota method %q", method)
+		}
+
+		switch quota.Key {
+		case "", KeyIP, KeyUser, KeyAPIKey:
+		default:
+			return fmt.Errorf("invalid key %q in the rate limit quota of %s", quota.Key, method)
+		}
+
+		ql := &quotaLimiter{quota: quota}
+		if quota.Limit > 0 {
+			window, err := time.ParseDuration(quota.Window)
+			if err != nil {
+				return fmt.Errorf("invalid window in the rate limit quota of %s: %w", method, err)
+			}
+
+			algorithm := quota.Algorithm
+			if algorithm == "" {
+				algorithm = q.algorithm
+			}
+
+			// Counters are named after the quota, so they survive reloads
+			ql.limiter, err = New(algorithm, "rpc:"+method, quota.Limit, window, q.store)
+			if err != nil {
+				return fmt.Errorf("invalid rate limit quota of %s: %w", method, err)
+			}
+		}
+		limiters[method] = ql
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limiters = limiters
+	q.apiKeys = apiKeys
+	q.modTime = info.ModTime()
+	return nil
+}
+
+// validAPIKey reports whether the digest of an API key is listed.
+func (q *Quotas) validAPIKey(digest string) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.apiKeys[digest]
+}
+
+// lookup returns the quota covering method, nil when there is none.
+func (q *Quotas) lookup(method string) *quotaLimiter {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if ql, ok := q.limiters[method]; ok {
+		return ql
+	}
+
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if ql, ok := q.limiters[method[:i+1]+"*"]; ok {
+			return ql
+		}
+	}
+
+	return q.limiters["*"]
+}
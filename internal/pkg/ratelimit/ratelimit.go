@@ -1,68 +1,176 @@
 package ratelimit
 
 import (
-	"sync"
+	"errors"
+	"fmt"
 	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Algorithms limiters can count attempts with
+const (
+	// FixedWindow allows the limit within a window starting with the first
+	// attempt, so bursts of twice the limit can straddle two windows.
+	FixedWindow = "fixed_window"
+	// SlidingLog remembers the time of every allowed attempt within the
+	// window. It is exact, but keeps up to the limit of times per key.
+	SlidingLog = "sliding_log"
+	// SlidingWindow counts attempts in aligned windows and weighs the count
+	// of the previous window by how much of it is still inside the sliding
+	// window.
+	SlidingWindow = "sliding_window"
+	// TokenBucket holds up to the limit of tokens, refilled evenly over the
+	// window, and every attempt takes one.
+	TokenBucket = "token_bucket"
 )
 
-type RateLimiter struct {
-	attempts    map[string]*attemptInfo
-	mu          sync.RWMutex
-	maxAttempts int
-	window      time.Duration
+// Limiter allows up to a number of attempts per key within a window.
+// Limiters backed by a shared store count the attempts of every replica
+// together.
+type Limiter interface {
+	// Allow counts an attempt for key and reports whether it is within the
+	// limit. It returns an error when the store cannot be reached, and
+	// denies attempts the store could not count for contention.
+	Allow(key string) (Result, error)
+
+	// Peek reports whether an attempt for key would be allowed, without
+	// counting it. Callers can check before expensive work and count with
+	// Allow only once it succeeded.
+	Peek(key string) (Result, error)
+}
+
+// Result is the outcome of an attempt.
+type Result struct {
+	Allowed bool
+
+	// Limit is the number of attempts allowed within the window, and
+	// Remaining how many of them are left after this one
+	Limit     int
+	Remaining int
+
+	// ResetAt is when the whole limit is available again
+	ResetAt time.Time
+
+	// RetryAfter is how long a denied caller has to wait before its next
+	// attempt can be allowed, 0 for allowed attempts
+	RetryAfter time.Duration
+}
+
+// LimitError is returned for attempts a limiter denied.
+type LimitError struct {
+	Message    string
+	RetryAfter time.Duration
 }
 
-type attemptInfo struct {
-	count     int
-	firstTime time.Time
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// GRPCStatus reports the error as RESOURCE_EXHAUSTED, with a RetryInfo
+// detail telling clients when to retry.
+func (e *LimitError) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, e.Message)
+
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(e.RetryAfter),
+	})
+	if err != nil {
+		return st
+	}
+
+	return detailed
 }
 
-func NewRateLimiter(maxAttempts int, window time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		attempts:    make(map[string]*attemptInfo),
-		maxAttempts: maxAttempts,
-		window:      window,
+var ErrInvalidLimit = errors.New("rate limits need at least one attempt and a window")
+
+// New returns a limiter counting with algorithm, one of the algorithm
+// constants, in store. Name separates the counters of limiters sharing a
+// store. Without an algorithm the fixed window is used.
+func New(algorithm, name string, limit int, window time.Duration, store Store) (Limiter, error) {
+	if limit < 1 || window <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	l := &storeLimiter{
+		store:  store,
+		name:   name,
+		limit:  limit,
+		window: window,
+	}
+
+	switch algorithm {
+	case "", FixedWindow:
+		l.count = fixedWindow
+	case SlidingLog:
+		l.count = slidingLog
+	case SlidingWindow:
+		l.count = slidingWindow
+	case TokenBucket:
+		l.count = tokenBucket
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", algorithm)
 	}
 
-	go rl.cleanup()
-	return rl
+	return l, nil
 }
 
-func (rl *RateLimiter) Allow(key string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// storeLimiter keeps the State of every key in a store and lets its
+// algorithm count attempts on it.
+type storeLimiter struct {
+	store  Store
+	name   string
+	limit  int
+	window time.Duration
+	count  algorithm
+}
+
+// contendedRetryAfter is how long callers denied for contention wait
+const contendedRetryAfter = time.Second
 
-	now := time.Now()
-	info, exists := rl.attempts[key]
+func (l *storeLimiter) Allow(key string) (Result, error) {
+	// Shared stores keep times in milliseconds
+	now := time.Now().Truncate(time.Millisecond)
 
-	if !exists || now.Sub(info.firstTime) > rl.window {
-		rl.attempts[key] = &attemptInfo{
-			count:     1,
-			firstTime: now,
-		}
-		return true
+	state, allowed, err := l.store.Count(l.name+":"+key, l.count, now, l.limit, l.window)
+	if errors.Is(err, ErrContended) {
+		// An attempt that could not be counted is not let through
+		return l.contended(now), nil
+	}
+	if err != nil {
+		return Result{}, err
 	}
 
-	if info.count >= rl.maxAttempts {
-		return false
+	result, _ := l.count.result(&state, allowed, now, l.limit, l.window)
+	result.Limit = l.limit
+	return result, nil
+}
+
+func (l *storeLimiter) Peek(key string) (Result, error) {
+	now := time.Now().Truncate(time.Millisecond)
+
+	// Count on the state read, which is not written back
+	state, err := l.store.Get(l.name + ":" + key)
+	if err != nil {
+		return Result{}, err
 	}
 
-	info.count++
-	return true
+	result, _ := l.count.count(&state, now, l.limit, l.window)
+	result.Limit = l.limit
+	if result.Allowed {
+		// The attempt was not counted
+		result.Remaining++
+	}
+	return result, nil
 }
 
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(rl.window)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, info := range rl.attempts {
-			if now.Sub(info.firstTime) > rl.window {
-				delete(rl.attempts, key)
-			}
-		}
-		rl.mu.Unlock()
+func (l *storeLimiter) contended(now time.Time) Result {
+	return Result{
+		Limit:      l.limit,
+		ResetAt:    now.Add(contendedRetryAfter),
+		RetryAfter: contendedRetryAfter,
 	}
 }
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeekDoesNotCount(t *testing.T) {
+	for _, algorithm := range []string{FixedWindow, SlidingLog, SlidingWindow, TokenBucket} {
+		t.Run(algorithm, func(t *testing.T) {
+			limiter, err := New(algorithm, "test", 2, time.Hour, NewMemoryStore())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for range 5 {
+				result, err := limiter.Peek("key")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed || result.Remaining != 2 {
+					t.Fatalf("peek = %+v, want allowed with 2 remaining", result)
+				}
+			}
+
+			for i := range 2 {
+				if result, err := limiter.Allow("key"); err != nil || !result.Allowed {
+					t.Fatalf("attempt %d = %+v, %v, want allowed", i+1, result, err)
+				}
+			}
+
+			result, err := limiter.Peek("key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed || result.RetryAfter <= 0 {
+				t.Errorf("peek over the limit = %+v, want denied with a retry delay", result)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidLimits(t *testing.T) {
+	store := NewMemoryStore()
+
+	if _, err := New(FixedWindow, "test", 0, time.Minute, store); err != ErrInvalidLimit {
+		t.Errorf("limit 0: err = %v, want ErrInvalidLimit", err)
+	}
+	if _, err := New(FixedWindow, "test", 1, 0, store); err != ErrInvalidLimit {
+		t.Errorf("window 0: err = %v, want ErrInvalidLimit", err)
+	}
+	if _, err := New("leaky", "test", 1, time.Minute, store); err == nil {
+		t.Error("accepted an unknown algorithm")
+	}
+}
+
+// contendedStore never manages to count an attempt.
+type contendedStore struct {
+	Store
+}
+
+func (contendedStore) Count(key string, count algorithm, now time.Time, limit int, window time.Duration) (State, bool, error) {
+	return State{}, false, ErrContended
+}
+
+func TestAllowDeniesContendedAttempts(t *testing.T) {
+	limiter, err := New(FixedWindow, "test", 5, time.Minute, contendedStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := limiter.Allow("key")
+	if err != nil {
+		t.Fatalf("err = %v, want a denied result", err)
+	}
+	if result.Allowed || result.Limit != 5 || result.RetryAfter != contendedRetryAfter {
+		t.Errorf("result = %+v, want denied with a retry delay of %v", result, contendedRetryAfter)
+	}
+}
@@ -0,0 +1,431 @@
+package ratelimit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisStore keeps states as JSON strings on a Redis server, or anything
+// else speaking the Redis protocol, with times in Unix milliseconds.
+// Attempts are counted by a Lua script, which the server runs without
+// interleaving other commands. Keys expire with their state.
+type RedisStore struct {
+	client *RedisClient
+}
+
+func NewRedisStore(client *RedisClient) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+// countScript runs the step of an algorithm on the state of KEYS[1]. ARGV
+// holds the algorithm, the time of the attempt, the limit and the window,
+// then the start of the window and the weight of the previous one for
+// sliding_window, or the refill interval for token_bucket. It returns 1
+// when the attempt was allowed, 0 otherwise, and the new state.
+const countScript = `
+local value = redis.call('GET', KEYS[1])
+local state = {}
+if value then
+  state = cjson.decode(value)
+end
+
+local algorithm = ARGV[1]
+local now = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local window = tonumber(ARGV[4])
+local allowed = false
+local expires_at
+
+if algorithm == 'fixed_window' then
+  if not state.start or now - state.start >= window then
+    state.start = now
+    state.count = 0
+  end
+  if state.count < limit then
+    state.count = state.count + 1
+    allowed = true
+  end
+  expires_at = state.start + window
+elseif algorithm == 'sliding_log' then
+  local hits = {}
+  local old = state.hits or {}
+  for i = 1, #old do
+    if old[i] > now - window then
+      hits[#hits + 1] = old[i]
+    end
+  end
+  if #hits < limit then
+    hits[#hits + 1] = now
+    allowed = true
+  end
+  state.hits = hits
+  expires_at = hits[#hits] + window
+elseif algorithm == 'sliding_window' then
+  local start = tonumber(ARGV[5])
+  local weight = tonumber(ARGV[6])
+  if state.start ~= start then
+    if state.start == start - window then
+      state.previous = state.count
+    else
+      state.previous = 0
+    end
+    state.start = start
+    state.count = 0
+  end
+  if (state.previous or 0) * weight + state.count + 1 <= limit then
+    state.count = state.count + 1
+    allowed = true
+  end
+  expires_at = start + 2 * window
+elseif algorithm == 'token_bucket' then
+  local interval = tonumber(ARGV[5])
+  local full = math.max(state.full_at or now, now)
+  if full + interval - now <= window then
+    state.full_at = full + interval
+    allowed = true
+  end
+  expires_at = state.full_at
+else
+  return redis.error_reply('unknown rate limit algorithm ' .. algorithm)
+end
+
+local encoded = cjson.encode(state)
+redis.call('SET', KEYS[1], encoded, 'PX', math.max(expires_at - now, 1))
+if allowed then
+  return {1, encoded}
+end
+return {0, encoded}
+`
+
+// redisState is how a State is kept on the server.
+type redisState struct {
+	Start    float64   `json:"start,omitempty"`
+	Count    int       `json:"count,omitempty"`
+	Previous int       `json:"previous,omitempty"`
+	Hits     []float64 `json:"hits,omitempty"`
+	FullAt   float64   `json:"full_at,omitempty"`
+}
+
+func (s *RedisStore) Count(key string, count algorithm, now time.Time, limit int, window time.Duration) (State, bool, error) {
+	args := []string{
+		"EVAL", countScript, "1", "ratelimit:" + key,
+		count.name, formatMillis(now), strconv.Itoa(limit), strconv.FormatInt(window.Milliseconds(), 10),
+	}
+
+	switch count.name {
+	case SlidingWindow:
+		start, weight := slidingWindowStart(now, window)
+		args = append(args, formatMillis(start), strconv.FormatFloat(weight, 'g', -1, 64))
+	case TokenBucket:
+		args = append(args, strconv.FormatInt(tokenInterval(limit, window).Milliseconds(), 10))
+	}
+
+	reply, err := s.client.Do(args)
+	if err != nil {
+		return State{}, false, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		return State{}, false, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+
+	allowed, _ := items[0].(int64)
+	data, _ := items[1].(string)
+	state, err := decodeRedisState(data)
+	if err != nil {
+		return State{}, false, err
+	}
+
+	return state, allowed == 1, nil
+}
+
+func (s *RedisStore) Get(key string) (State, error) {
+	reply, err := s.client.Do([]string{"GET", "ratelimit:" + key})
+	if err != nil || reply == nil {
+		return State{}, err
+	}
+
+	data, ok := reply.(string)
+	if !ok {
+		return State{}, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+
+	return decodeRedisState(data)
+}
+
+func (s *RedisStore) Delete(key string) error {
+	_, err := s.client.Do([]string{"DEL", "ratelimit:" + key})
+	return err
+}
+
+func decodeRedisState(data string) (State, error) {
+	var stored redisState
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return State{}, fmt.Errorf("invalid rate limit state: %w", err)
+	}
+
+	state := State{
+		Start:    parseMillis(stored.Start),
+		Count:    stored.Count,
+		Previous: stored.Previous,
+		FullAt:   parseMillis(stored.FullAt),
+	}
+	for _, hit := range stored.Hits {
+		state.Hits = append(state.Hits, parseMillis(hit))
+	}
+
+	return state, nil
+}
+
+func formatMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// parseMillis returns the time of a Unix millisecond count, zero for 0.
+func parseMillis(ms float64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(ms))
+}
+
+// RedisClient sends commands to a Redis server over a small pool of
+// connections, so concurrent calls do not wait for each other. Connections
+// left in an unknown state by a failure are closed and dialed again.
+type RedisClient struct {
+	addr     string
+	password string
+	timeout  time.Duration
+
+	// slots bounds the open connections, idle holds those not in use
+	slots chan struct{}
+	idle  chan *redisConn
+}
+
+// redisPoolSize is how many connections a client opens at most
+const redisPoolSize = 8
+
+func NewRedisClient(addr, password string) *RedisClient {
+	return &RedisClient{
+		addr:     addr,
+		password: password,
+		timeout:  2 * time.Second,
+		slots:    make(chan struct{}, redisPoolSize),
+		idle:     make(chan *redisConn, redisPoolSize),
+	}
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Do pipelines the commands and returns the reply to the last one. Replies
+// are strings, int64s, nil or slices of them.
+func (c *RedisClient) Do(commands ...[]string) (interface{}, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.put(conn)
+
+	return conn.run(commands)
+}
+
+// get takes an idle connection, or dials a new one while fewer than
+// redisPoolSize are open. It waits for a connection to be put back
+// otherwise.
+func (c *RedisClient) get() (*redisConn, error) {
+	c.slots <- struct{}{}
+
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// put returns a connection to the pool, closing it when it is broken.
+func (c *RedisClient) put(conn *redisConn) {
+	if conn.broken {
+		conn.conn.Close()
+	} else {
+		c.idle <- conn
+	}
+
+	<-c.slots
+}
+
+func (c *RedisClient) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{
+		conn:    netConn,
+		r:       bufio.NewReader(netConn),
+		timeout: c.timeout,
+	}
+
+	if c.password != "" {
+		if _, err := conn.run([][]string{{"AUTH", c.password}}); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// redisConn is a connection of the pool. It is broken once it is left in
+// an unknown state.
+type redisConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	broken  bool
+}
+
+// run sends the commands, marking the connection broken when it fails for
+// any reason but an error reply.
+func (c *redisConn) run(commands [][]string) (interface{}, error) {
+	if c.broken {
+		return nil, errors.New("redis: connection is broken")
+	}
+
+	reply, err := c.do(commands)
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			c.broken = true
+		}
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (c *redisConn) do(commands [][]string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	var buf []byte
+	for _, args := range commands {
+		buf = appendCommand(buf, args)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	// Read every reply so the next call starts in sync, but report the
+	// first error the server sent
+	var reply interface{}
+	var replyErr error
+	for range commands {
+		var err error
+		reply, err = readReply(c.r)
+		var re redisError
+		if errors.As(err, &re) {
+			if replyErr == nil {
+				replyErr = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if replyErr != nil {
+		return nil, replyErr
+	}
+
+	return reply, nil
+}
+
+// appendCommand encodes a command as an array of bulk strings.
+func appendCommand(buf []byte, args []string) []byte {
+	buf = fmt.Appendf(buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return buf
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("malformed redis reply")
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readReply(r)
+			// Errors inside a transaction's results are values
+			var re redisError
+			if errors.As(err, &re) {
+				items[i] = err
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type %q", line[0])
+	}
+}
@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit/internal/redistest"
+)
+
+func newRedisServer(t *testing.T, password string) *redistest.Server {
+	t.Helper()
+
+	srv, err := redistest.NewServer(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRedisStore(t *testing.T) {
+	srv := newRedisServer(t, "secret")
+	testStore(t, NewRedisStore(NewRedisClient(srv.Addr(), "secret")))
+}
+
+func TestRedisStoreKeyAndExpiry(t *testing.T) {
+	srv := newRedisServer(t, "")
+	store := NewRedisStore(NewRedisClient(srv.Addr(), ""))
+
+	countAttempt(t, store, "login:a")
+
+	value, ttl, ok := srv.Get("ratelimit:login:a")
+	if !ok {
+		t.Fatal("state was not stored under the prefixed key")
+	}
+	if state, err := decodeRedisState(value); err != nil || state.Count != 1 {
+		t.Errorf("value = %s, want the JSON state", value)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("ttl = %v, want up to a minute", ttl)
+	}
+}
+
+func TestRedisStoreMalformedState(t *testing.T) {
+	srv := newRedisServer(t, "")
+	store := NewRedisStore(NewRedisClient(srv.Addr(), ""))
+	srv.Set("ratelimit:bad", "not json")
+
+	if _, _, err := store.Count("bad", fixedWindow, time.Now(), 10, time.Minute); err == nil {
+		t.Fatal("counted on a malformed state")
+	}
+	if _, err := store.Get("bad"); err == nil {
+		t.Fatal("read a malformed state")
+	}
+
+	// The connection was given back in a usable state
+	countAttempt(t, store, "good")
+	if value, _, _ := srv.Get("ratelimit:bad"); value != "not json" {
+		t.Errorf("malformed state was overwritten with %q", value)
+	}
+}
+
+func TestRedisStoreUnknownAlgorithm(t *testing.T) {
+	srv := newRedisServer(t, "")
+	store := NewRedisStore(NewRedisClient(srv.Addr(), ""))
+
+	leaky := algorithm{name: "leaky_bucket"}
+	_, _, err := store.Count("key", leaky, time.Now(), 10, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "unknown rate limit algorithm") {
+		t.Fatalf("err = %v, want the script's error reply", err)
+	}
+	if _, _, ok := srv.Get("ratelimit:key"); ok {
+		t.Error("a state was stored for an unknown algorithm")
+	}
+}
+
+func TestRedisStoreErrorReplies(t *testing.T) {
+	tests := []struct {
+		command string
+		call    func(store *RedisStore) error
+	}{
+		{"EVAL", func(store *RedisStore) error {
+			_, _, err := store.Count("key", fixedWindow, time.Now(), 10, time.Minute)
+			return err
+		}},
+		{"GET", func(store *RedisStore) error {
+			_, err := store.Get("key")
+			return err
+		}},
+		{"DEL", func(store *RedisStore) error {
+			return store.Delete("key")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			srv := newRedisServer(t, "")
+			store := NewRedisStore(NewRedisClient(srv.Addr(), ""))
+
+			srv.FailWith(func(args []string) string {
+				if strings.EqualFold(args[0], tt.command) {
+					return "ERR injected failure"
+				}
+				return ""
+			})
+
+			err := tt.call(store)
+			var replyErr redisError
+			if !errors.As(err, &replyErr) || !strings.Contains(err.Error(), "injected failure") {
+				t.Fatalf("err = %v, want the error reply", err)
+			}
+
+			// The client recovers from an error reply
+			srv.FailWith(nil)
+			if err := tt.call(store); err != nil {
+				t.Fatalf("%s after an error reply: %v", tt.command, err)
+			}
+		})
+	}
+}
+
+func TestRedisClientAuth(t *testing.T) {
+	srv := newRedisServer(t, "secret")
+
+	if _, err := NewRedisClient(srv.Addr(), "wrong").Do([]string{"PING"}); err == nil {
+		t.Error("a wrong password was accepted")
+	}
+	if _, err := NewRedisClient(srv.Addr(), "").Do([]string{"PING"}); err == nil {
+		t.Error("a missing password was accepted")
+	}
+
+	reply, err := NewRedisClient(srv.Addr(), "secret").Do([]string{"PING"})
+	if err != nil || reply != "PONG" {
+		t.Errorf("reply = %v, %v, want PONG", reply, err)
+	}
+}
+
+func TestRedisClientReplies(t *testing.T) {
+	srv := newRedisServer(t, "")
+	client := NewRedisClient(srv.Addr(), "")
+
+	tests := []struct {
+		command []string
+		want    interface{}
+	}{
+		{[]string{"SET", "k", "v"}, "OK"},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"DEL", "k"}, int64(1)},
+		{[]string{"GET", "k"}, nil},
+	}
+
+	for _, tt := range tests {
+		reply, err := client.Do(tt.command)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.command, err)
+		}
+		if reply != tt.want {
+			t.Errorf("%v = %#v, want %#v", tt.command, reply, tt.want)
+		}
+	}
+
+	// Pipelined commands reply with the last one, but report any error
+	reply, err := client.Do([]string{"SET", "k", "1"}, []string{"GET", "k"})
+	if err != nil || reply != "1" {
+		t.Errorf("pipeline = %v, %v, want 1", reply, err)
+	}
+	if _, err := client.Do([]string{"NOPE"}, []string{"GET", "k"}); err == nil {
+		t.Error("pipeline hid an error reply")
+	}
+}
+
+func TestRedisClientUnreachable(t *testing.T) {
+	// Take a free port and release it so nothing listens on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	store := NewRedisStore(NewRedisClient(addr, ""))
+	if _, _, err := store.Count("key", fixedWindow, time.Now(), 10, time.Minute); err == nil {
+		t.Fatal("counted without a server")
+	}
+}
+
+func TestRedisClientRedialsDroppedConnections(t *testing.T) {
+	srv := newRedisServer(t, "")
+	store := NewRedisStore(NewRedisClient(srv.Addr(), ""))
+
+	countAttempt(t, store, "key")
+
+	srv.CloseConnections()
+
+	// The pooled connection may only notice the drop when it is used, but
+	// it is then replaced
+	store.Get("key")
+	if _, _, err := store.Count("key", fixedWindow, time.Now(), 10, time.Minute); err != nil {
+		t.Fatalf("count after the connection was dropped: %v", err)
+	}
+}
+
+func TestRedisClientPoolBound(t *testing.T) {
+	srv := newRedisServer(t, "")
+	store := NewRedisStore(NewRedisClient(srv.Addr(), ""))
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			key := string(rune('a' + i%26))
+			if _, _, err := store.Count(key, fixedWindow, time.Now(), 10, time.Minute); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := srv.PeakConnections(); peak > redisPoolSize {
+		t.Errorf("%d connections were open at once, want at most %d", peak, redisPoolSize)
+	}
+}
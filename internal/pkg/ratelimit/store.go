@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// State is what a limiter keeps per key. Each algorithm uses some of the
+// fields.
+type State struct {
+	// Start of the current window and the attempts counted in it, and in
+	// the window before it
+	Start    time.Time `bson:"start,omitempty" json:"start,omitempty"`
+	Count    int       `bson:"count,omitempty" json:"count,omitempty"`
+	Previous int       `bson:"previous,omitempty" json:"previous,omitempty"`
+
+	// Times of the attempts within the window, oldest first
+	Hits []time.Time `bson:"hits,omitempty" json:"hits,omitempty"`
+
+	// When the token bucket is full again
+	FullAt time.Time `bson:"full_at,omitempty" json:"full_at,omitempty"`
+}
+
+// Store keeps the State of every key. Attempts are counted atomically, so
+// concurrent attempts of every replica sharing the store are each counted
+// once.
+type Store interface {
+	// Count runs the step of count for an attempt made at now on the state
+	// of key, zero when there is none, and returns the state after it and
+	// whether the attempt was allowed.
+	Count(key string, count algorithm, now time.Time, limit int, window time.Duration) (State, bool, error)
+
+	// Get returns the state of key, zero when there is none or it expired.
+	Get(key string) (State, error)
+
+	// Delete forgets the state of key.
+	Delete(key string) error
+}
+
+// ErrContended is returned when concurrent attempts kept a store from
+// counting an attempt. Limiters deny such attempts.
+var ErrContended = errors.New("rate limit state changed concurrently, try again")
+
+// updateRetries is how many times stores try to count a contended attempt
+const updateRetries = 5
+
+// NewStore returns the store selected by kind: "memory" keeps states in
+// this process, "mongo" in a collection of db and "redis" on the server of
+// client.
+func NewStore(kind string, db *mongo.Database, client *RedisClient) (Store, error) {
+	switch kind {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "mongo":
+		return NewMongoStore(db), nil
+	case "redis":
+		return NewRedisStore(client), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", kind)
+	}
+}
+
+// MemoryStore keeps states in this process, so they are lost on restart
+// and not shared between replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryStore) Count(key string, count algorithm, now time.Time, limit int, window time.Duration) (State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state State
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expiresAt) {
+		state = entry.state
+	}
+
+	allowed := count.step(&state, now, limit, window)
+	_, expiresAt := count.result(&state, allowed, now, limit, window)
+	s.entries[key] = &memoryEntry{state: state, expiresAt: expiresAt}
+
+	state.Hits = slices.Clone(state.Hits)
+	return state, allowed, nil
+}
+
+func (s *MemoryStore) Get(key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return State{}, nil
+	}
+
+	state := entry.state
+	state.Hits = slices.Clone(state.Hits)
+	return state, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, entry := range s.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
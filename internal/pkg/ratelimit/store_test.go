@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// countAttempt counts an attempt for key in a fixed window of a minute.
+func countAttempt(t *testing.T, store Store, key string) State {
+	t.Helper()
+
+	state, _, err := store.Count(key, fixedWindow, time.Now().Truncate(time.Millisecond), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("counting %s: %v", key, err)
+	}
+	return state
+}
+
+// readState returns the state of key.
+func readState(t *testing.T, store Store, key string) State {
+	t.Helper()
+
+	state, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return state
+}
+
+// testStore checks the behavior every Store shares.
+func testStore(t *testing.T, store Store) {
+	t.Run("missing key is zero", func(t *testing.T) {
+		if state := readState(t, store, "missing"); state.Count != 0 || !state.Start.IsZero() || state.Hits != nil {
+			t.Errorf("state = %+v, want zero", state)
+		}
+	})
+
+	t.Run("state round trip", func(t *testing.T) {
+		now := time.Now().Truncate(time.Millisecond)
+
+		for _, count := range []algorithm{fixedWindow, slidingLog, slidingWindow, tokenBucket} {
+			key := "round-trip:" + count.name
+			for range 2 {
+				if _, _, err := store.Count(key, count, now, 10, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			counted, allowed, err := store.Count(key, count, now, 10, time.Minute)
+			if err != nil || !allowed {
+				t.Fatalf("%s: allowed = %v, %v, want allowed", count.name, allowed, err)
+			}
+
+			got := readState(t, store, key)
+			if !got.Start.Equal(counted.Start) || got.Count != counted.Count || got.Previous != counted.Previous ||
+				len(got.Hits) != len(counted.Hits) || !got.FullAt.Equal(counted.FullAt) {
+				t.Errorf("%s: state = %+v, want %+v", count.name, got, counted)
+			}
+			if count.name == FixedWindow && (got.Count != 3 || !got.Start.Equal(now)) {
+				t.Errorf("fixed window state = %+v, want 3 attempts from %v", got, now)
+			}
+			if count.name == SlidingLog && (len(got.Hits) != 3 || !got.Hits[2].Equal(now)) {
+				t.Errorf("sliding log state = %+v, want 3 hits at %v", got, now)
+			}
+		}
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		for range 3 {
+			countAttempt(t, store, "a")
+		}
+		countAttempt(t, store, "b")
+
+		if a, b := readState(t, store, "a").Count, readState(t, store, "b").Count; a != 3 || b != 1 {
+			t.Errorf("counts = %d and %d, want 3 and 1", a, b)
+		}
+	})
+
+	t.Run("expired state is dropped", func(t *testing.T) {
+		now := time.Now().Truncate(time.Millisecond)
+		if _, _, err := store.Count("expiring", fixedWindow, now, 10, 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		if count := readState(t, store, "expiring").Count; count != 0 {
+			t.Errorf("count = %d after expiry, want 0", count)
+		}
+	})
+
+	t.Run("deleted state is zero", func(t *testing.T) {
+		countAttempt(t, store, "deleted")
+		if err := store.Delete("deleted"); err != nil {
+			t.Fatal(err)
+		}
+
+		if count := readState(t, store, "deleted").Count; count != 0 {
+			t.Errorf("count = %d after delete, want 0", count)
+		}
+		if count := countAttempt(t, store, "deleted").Count; count != 1 {
+			t.Errorf("count = %d after counting again, want 1", count)
+		}
+	})
+
+	t.Run("concurrent attempts stay within the limit", func(t *testing.T) {
+		limiter, err := New(FixedWindow, "concurrent", 5, time.Minute, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+
+		for range 200 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				result, err := limiter.Allow("key")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if result.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed == 0 || allowed > 5 {
+			t.Errorf("%d of 200 concurrent attempts were allowed, want up to 5", allowed)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestNewStore(t *testing.T) {
+	for _, kind := range []string{"", "memory"} {
+		store, err := NewStore(kind, nil, nil)
+		if err != nil {
+			t.Fatalf("kind %q: %v", kind, err)
+		}
+		if _, ok := store.(*MemoryStore); !ok {
+			t.Errorf("kind %q gave %T, want *MemoryStore", kind, store)
+		}
+	}
+
+	if _, err := NewStore("cassandra", nil, nil); err == nil {
+		t.Error("accepted an unknown store")
+	}
+}
@@ -0,0 +1,110 @@
+package rbac
+
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleUser    = "user"
+)
+
+// Permission allows acting on resources other than the caller's own.
+// Managing one's own profile only requires authentication.
+type Permission string
+
+const (
+	PermUsersList   Permission = "users.list"
+	PermUsersRead   Permission = "users.read"
+	PermUsersUpdate Permission = "users.update"
+	PermUsersDelete Permission = "users.delete"
+
+	PermUsersSuspend       Permission = "users.suspend"
+	PermUsersUnlock        Permission = "users.unlock"
+	PermUsersResetPassword Permission = "users.reset_password"
+	PermUsersPurge         Permission = "users.purge"
+	PermRolesAssign        Permission = "roles.assign"
+	PermAuditRead          Permission = "audit.read"
+	PermAttributesManage   Permission = "attributes.manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermUsersList,
+		PermUsersRead,
+		PermUsersUpdate,
+		PermUsersDelete,
+		PermUsersSuspend,
+		PermUsersUnlock,
+		PermUsersResetPassword,
+		PermUsersPurge,
+		PermRolesAssign,
+		PermAuditRead,
+		PermAttributesManage,
+	},
+	RoleSupport: {
+		PermUsersList,
+		PermUsersRead,
+		PermUsersSuspend,
+		PermUsersUnlock,
+		PermUsersResetPassword,
+	},
+	RoleUser: {},
+}
+
+// roleRanks orders the roles from least to most privileged.
+var roleRanks = map[string]int{
+	RoleUser:    0,
+	RoleSupport: 1,
+	RoleAdmin:   2,
+}
+
+// ValidRole reports whether role is known.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether any of roles grants permission. Unknown
+// roles grant nothing.
+func HasPermission(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CanManage reports whether a caller holding actorRoles may act on an
+// account holding targetRoles: the account holds no role the caller does
+// not, and none ranked above the caller's. Ranked roles include those ranked
+// below them.
+func CanManage(actorRoles, targetRoles []string) bool {
+	top := -1
+	for _, role := range actorRoles {
+		if rank, ok := roleRanks[role]; ok && rank > top {
+			top = rank
+		}
+	}
+
+	for _, role := range targetRoles {
+		rank, ranked := roleRanks[role]
+		if ranked && rank > top || !ranked && !HasRole(actorRoles, role) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HasRole reports whether roles contains role.
+func HasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
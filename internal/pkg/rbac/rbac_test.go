@@ -0,0 +1,33 @@
+package rbac
+
+import "testing"
+
+func TestCanManage(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  []string
+		target []string
+		want   bool
+	}{
+		{"admin manages user", []string{RoleAdmin}, []string{RoleUser}, true},
+		{"admin manages support", []string{RoleAdmin}, []string{RoleSupport, RoleUser}, true},
+		{"admin manages admin", []string{RoleAdmin}, []string{RoleAdmin}, true},
+		{"support manages user", []string{RoleSupport}, []string{RoleUser}, true},
+		{"support manages support", []string{RoleSupport}, []string{RoleSupport}, true},
+		{"user manages support", []string{RoleUser}, []string{RoleSupport}, false},
+		{"support manages admin", []string{RoleSupport, RoleUser}, []string{RoleAdmin}, false},
+		{"support manages admin holding support", []string{RoleSupport}, []string{RoleAdmin, RoleSupport}, false},
+		{"support manages user without roles", []string{RoleSupport}, nil, true},
+		{"unknown target role", []string{RoleAdmin}, []string{"owner"}, false},
+		{"unknown role held by both", []string{RoleSupport, "owner"}, []string{"owner", RoleUser}, true},
+		{"no actor roles", nil, []string{RoleUser}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanManage(tt.actor, tt.target); got != tt.want {
+				t.Errorf("CanManage(%v, %v) = %v, want %v", tt.actor, tt.target, got, tt.want)
+			}
+		})
+	}
+}
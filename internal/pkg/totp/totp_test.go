@@ -0,0 +1,117 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA-1 secret of the RFC 6238 test vectors, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := GenerateCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateCode at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCodeLowercaseSecret(t *testing.T) {
+	got, err := GenerateCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", time.Unix(59, 0))
+	if err != nil || got != "287082" {
+		t.Errorf("GenerateCode = %s, %v, want 287082", got, err)
+	}
+}
+
+func TestValidateDrift(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / period
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -period * time.Second, true},
+		{"one step ahead", period * time.Second, true},
+		{"two steps behind", -2 * period * time.Second, false},
+		{"two steps ahead", 2 * period * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := GenerateCode(rfcSecret, now.Add(tt.offset))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok := Validate(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("Validate = %v, want %v", ok, tt.ok)
+			}
+
+			want := current + int64(tt.offset/(period*time.Second))
+			if ok && step != want {
+				t.Errorf("step = %d, want %d", step, want)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfcSecret, "000000"},
+		{"short code", rfcSecret, "28708"},
+		{"long code", rfcSecret, "2870820"},
+		{"empty code", rfcSecret, ""},
+		{"invalid secret", "not base32!", "287082"},
+	}
+
+	for _, tt := range tests {
+		if _, ok := Validate(tt.secret, tt.code, now); ok {
+			t.Errorf("%s: Validate accepted %q", tt.name, tt.code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 160 bits are 32 base32 characters
+	if len(secret) != 32 {
+		t.Errorf("secret %q has %d characters, want 32", secret, len(secret))
+	}
+
+	code, err := GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(secret, code, time.Now()); !ok {
+		t.Error("a generated secret does not validate its own code")
+	}
+}
@@ -2,7 +2,12 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
 
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
 	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
 	pb "github.com/nightnice1st/testGridWhiz/pb"
 
@@ -22,33 +27,52 @@ func NewUserHandler(userUsecase domain.UserUsecase) *UserHandler {
 }
 
 func (h *UserHandler) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
-	users, total, err := h.userUsecase.ListUsers(
-		int(req.Page),
-		int(req.Limit),
-		req.NameFilter,
-		req.EmailFilter,
-	)
+	opts := domain.ListOptions{
+		Page:        int(req.Page),
+		Limit:       int(req.Limit),
+		PageToken:   req.PageToken,
+		NameFilter:  req.NameFilter,
+		EmailFilter: req.EmailFilter,
+		Query:       req.Query,
+		Status:      req.Status,
+		Role:        req.Role,
+		SortBy:      req.SortBy,
+		SortOrder:   req.SortOrder,
+		SkipTotal:   req.SkipTotal,
+	}
+
+	var err error
+	if req.CreatedAfter != "" {
+		if opts.CreatedAfter, err = time.Parse(time.RFC3339, req.CreatedAfter); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid created_after")
+		}
+	}
+	if req.CreatedBefore != "" {
+		if opts.CreatedBefore, err = time.Parse(time.RFC3339, req.CreatedBefore); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid created_before")
+		}
+	}
+
+	page, err := h.userUsecase.ListUsers(opts)
 
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidListOptions) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	pbUsers := make([]*pb.User, len(users))
-	for i, user := range users {
-		pbUsers[i] = &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		}
+	pbUsers := make([]*pb.User, len(page.Users))
+	for i, user := range page.Users {
+		pbUsers[i] = ToProtoUser(user)
 	}
 
 	return &pb.ListUsersResponse{
-		Users: pbUsers,
-		Total: int32(total),
-		Page:  req.Page,
-		Limit: req.Limit,
+		Users:         pbUsers,
+		Total:         int32(page.Total),
+		Page:          req.Page,
+		Limit:         req.Limit,
+		NextPageToken: page.NextPageToken,
 	}, nil
 }
 
@@ -69,56 +93,87 @@ func (h *UserHandler) GetProfile(ctx context.Context, req *pb.GetProfileRequest)
 	}
 
 	return &pb.GetProfileResponse{
-		User: &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		},
+		User: ToProtoUser(user),
 	}, nil
 }
 
 func (h *UserHandler) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error) {
-	// Get userID from context - users can only update their own profile
+	// Get userID from context, updating another profile is authorized by the
+	// interceptor
 	userID, ok := ctx.Value("userID").(string)
 	if !ok {
 		return nil, status.Error(codes.Unauthenticated, "authentication required")
 	}
 
-	// Ensure user is updating their own profile
-	if req.UserId != "" && req.UserId != userID {
-		return nil, status.Error(codes.PermissionDenied, "can only update own profile")
+	if req.UserId != "" {
+		userID = req.UserId
+	}
+
+	update := domain.ProfileUpdate{
+		Paths: req.UpdateMask.GetPaths(),
+		Profile: domain.User{
+			Name:       req.Name,
+			Email:      req.Email,
+			AvatarURL:  req.AvatarUrl,
+			Phone:      req.Phone,
+			Locale:     req.Locale,
+			Timezone:   req.Timezone,
+			Bio:        req.Bio,
+			Attributes: req.Attributes,
+		},
+		IfMatch: req.Etag,
 	}
 
-	user, err := h.userUsecase.UpdateProfile(userID, req.Name)
+	user, err := h.userUsecase.UpdateProfile(userID, update)
 	if err != nil {
+		if errors.Is(err, domain.ErrVersionConflict) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	// A new email address has to be confirmed before it is applied
+	message := "Profile updated successfully"
+	emailChanged := req.Email != "" && len(update.Paths) == 0
+	if emailChanged || slices.Contains(update.Paths, domain.FieldEmail) {
+		message = "Profile updated successfully, confirm the new email address to complete the change"
+	}
+
 	return &pb.UpdateProfileResponse{
 		Success: true,
-		Message: "Profile updated successfully",
-		User: &pb.User{
-			Id:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		},
+		Message: message,
+		User:    ToProtoUser(user),
+	}, nil
+}
+
+func (h *UserHandler) ConfirmEmailChange(ctx context.Context, req *pb.ConfirmEmailChangeRequest) (*pb.ConfirmEmailChangeResponse, error) {
+	userID, ok := ctx.Value("userID").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	user, err := h.userUsecase.ConfirmEmailChange(userID, req.Token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.ConfirmEmailChangeResponse{
+		Success: true,
+		Message: "Email address changed successfully, please log in again",
+		User:    ToProtoUser(user),
 	}, nil
 }
 
 func (h *UserHandler) DeleteProfile(ctx context.Context, req *pb.DeleteProfileRequest) (*pb.DeleteProfileResponse, error) {
-	// Get userID from context - users can only delete their own profile
+	// Get userID from context, deleting another profile is authorized by the
+	// interceptor
 	userID, ok := ctx.Value("userID").(string)
 	if !ok {
 		return nil, status.Error(codes.Unauthenticated, "authentication required")
 	}
 
-	// Ensure user is deleting their own profile
-	if req.UserId != "" && req.UserId != userID {
-		return nil, status.Error(codes.PermissionDenied, "can only delete own profile")
+	if req.UserId != "" {
+		userID = req.UserId
 	}
 
 	err := h.userUsecase.DeleteProfile(userID)
@@ -131,3 +186,175 @@ func (h *UserHandler) DeleteProfile(ctx context.Context, req *pb.DeleteProfileRe
 		Message: "Profile deleted successfully",
 	}, nil
 }
+
+// Size of the chunks personal data exports are streamed in
+const exportChunkSize = 64 * 1024
+
+func (h *UserHandler) ExportMyData(req *pb.ExportMyDataRequest, stream pb.UserService_ExportMyDataServer) error {
+	userID, ok := stream.Context().Value("userID").(string)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	export, err := h.userUsecase.ExportMyData(userID, req.Format)
+	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			return limitErr.GRPCStatus().Err()
+		}
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	// The first chunk describes the file, even when it is empty
+	chunk := &pb.ExportMyDataChunk{
+		Filename:    export.Filename,
+		ContentType: export.ContentType,
+		Size:        int64(len(export.Data)),
+	}
+
+	data := export.Data
+	for {
+		n := min(len(data), exportChunkSize)
+		chunk.Data = data[:n]
+		data = data[n:]
+
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+		chunk = &pb.ExportMyDataChunk{}
+	}
+}
+
+// UploadAvatar receives an image in chunks and stores it as the caller's
+// avatar.
+func (h *UserHandler) UploadAvatar(stream pb.UserService_UploadAvatarServer) error {
+	userID, ok := stream.Context().Value("userID").(string)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "image data required")
+	}
+	if err != nil {
+		return err
+	}
+
+	r := &avatarReader{stream: stream, data: first.Data}
+	user, err := h.userUsecase.UploadAvatar(userID, first.ContentType, r)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAvatar) {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return stream.SendAndClose(&pb.UploadAvatarResponse{
+		Success: true,
+		Message: "Avatar uploaded successfully",
+		User:    ToProtoUser(user),
+	})
+}
+
+// Size of the chunks avatars are streamed in
+const avatarChunkSize = 64 * 1024
+
+func (h *UserHandler) GetAvatar(req *pb.GetAvatarRequest, stream pb.UserService_GetAvatarServer) error {
+	userID := req.UserId
+	if userID == "" {
+		ctxUserID, ok := stream.Context().Value("userID").(string)
+		if !ok {
+			return status.Error(codes.InvalidArgument, "user ID required")
+		}
+		userID = ctxUserID
+	}
+
+	avatar, err := h.userUsecase.GetAvatar(userID, req.Size)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAvatar) {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	// The first chunk describes the image
+	chunk := &pb.AvatarChunk{
+		ContentType: avatar.ContentType,
+		Size:        int64(len(avatar.Data)),
+	}
+
+	data := avatar.Data
+	for {
+		n := min(len(data), avatarChunkSize)
+		chunk.Data = data[:n]
+		data = data[n:]
+
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+		chunk = &pb.AvatarChunk{}
+	}
+}
+
+// avatarReader reads the data of the chunks of an avatar upload.
+type avatarReader struct {
+	stream pb.UserService_UploadAvatarServer
+	data   []byte
+}
+
+func (r *avatarReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = chunk.Data
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// ToProtoUser converts a user for responses of any service.
+func ToProtoUser(user *domain.User) *pb.User {
+	pbUser := &pb.User{
+		Id:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		CreatedAt:     user.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:     user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		EmailVerified: user.EmailVerified,
+		Roles:         user.Roles,
+		Suspended:     user.Status == domain.StatusSuspended,
+		Status:        user.Status,
+		StatusReason:  user.StatusReason,
+		AvatarUrl:     user.AvatarURL,
+		Phone:         user.Phone,
+		Locale:        user.Locale,
+		Timezone:      user.Timezone,
+		Bio:           user.Bio,
+		Attributes:    user.Attributes,
+		Etag:          user.ETag(),
+	}
+	if user.Avatar != nil {
+		pbUser.AvatarId = user.Avatar.ID
+	}
+	if !user.StatusChangedAt.IsZero() {
+		pbUser.StatusChangedAt = user.StatusChangedAt.Format("2006-01-02T15:04:05Z")
+	}
+	if !user.DeletedAt.IsZero() {
+		pbUser.DeletedAt = user.DeletedAt.Format("2006-01-02T15:04:05Z")
+	}
+
+	return pbUser
+}
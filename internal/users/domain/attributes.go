@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Types of custom attribute values
+const (
+	AttributeString = "string"
+	AttributeNumber = "number"
+	AttributeBool   = "bool"
+	AttributeEnum   = "enum"
+)
+
+// Longest string attribute accepted when the definition sets no limit
+const DefaultAttributeLength = 256
+
+// AttributeDefinition describes a custom profile attribute. Admins manage
+// the definitions and users can only set attributes that are defined.
+type AttributeDefinition struct {
+	Key         string    `bson:"_id"`
+	Type        string    `bson:"type"`
+	Description string    `bson:"description,omitempty"`
+	MaxLength   int       `bson:"max_length,omitempty"`
+	Options     []string  `bson:"options,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+type AttributeSchemaRepository interface {
+	List() ([]*AttributeDefinition, error)
+	Find(key string) (*AttributeDefinition, error)
+	Save(def *AttributeDefinition) error
+	Delete(key string) error
+}
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Validate checks that the definition itself is usable.
+func (d *AttributeDefinition) Validate() error {
+	if !attributeKeyPattern.MatchString(d.Key) {
+		return errors.New("attribute key must be 1 to 32 lowercase letters, digits or underscores, starting with a letter")
+	}
+
+	switch d.Type {
+	case AttributeString:
+		if d.MaxLength < 0 || d.MaxLength > 4096 {
+			return errors.New("max length must be between 0 and 4096")
+		}
+	case AttributeNumber, AttributeBool:
+	case AttributeEnum:
+		if len(d.Options) == 0 {
+			return errors.New("enum attributes need at least one option")
+		}
+		for _, option := range d.Options {
+			if option == "" {
+				return errors.New("enum options cannot be empty")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown attribute type %q", d.Type)
+	}
+
+	if d.Type != AttributeEnum && len(d.Options) > 0 {
+		return errors.New("only enum attributes have options")
+	}
+
+	return nil
+}
+
+// Normalize validates value against the definition and returns it as
+// stored.
+func (d *AttributeDefinition) Normalize(value string) (string, error) {
+	switch d.Type {
+	case AttributeString:
+		maxLength := d.MaxLength
+		if maxLength == 0 {
+			maxLength = DefaultAttributeLength
+		}
+		if utf8.RuneCountInString(value) > maxLength {
+			return "", fmt.Errorf("attribute %s must be at most %d characters long", d.Key, maxLength)
+		}
+		return value, nil
+	case AttributeNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return "", fmt.Errorf("attribute %s must be a number", d.Key)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case AttributeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("attribute %s must be true or false", d.Key)
+		}
+		return strconv.FormatBool(b), nil
+	case AttributeEnum:
+		if !slices.Contains(d.Options, value) {
+			return "", fmt.Errorf("attribute %s must be one of %v", d.Key, d.Options)
+		}
+		return value, nil
+	}
+
+	return "", fmt.Errorf("attribute %s has unknown type %q", d.Key, d.Type)
+}
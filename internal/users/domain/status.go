@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Account statuses
+const (
+	// The email address has not been verified yet
+	StatusPending = "pending"
+	StatusActive  = "active"
+	// Blocked by an operator until reinstated
+	StatusSuspended = "suspended"
+	// Blocked after too many failed logins until unlocked
+	StatusLocked = "locked"
+	// Soft deleted, restorable until the grace period ends
+	StatusDeleted = "deleted"
+)
+
+// Statuses each status can change to
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusActive, StatusSuspended, StatusLocked, StatusDeleted},
+	StatusActive:    {StatusSuspended, StatusLocked, StatusDeleted},
+	StatusSuspended: {StatusPending, StatusActive, StatusDeleted},
+	StatusLocked:    {StatusPending, StatusActive, StatusSuspended, StatusDeleted},
+	StatusDeleted:   {StatusPending, StatusActive, StatusSuspended, StatusLocked},
+}
+
+// Number of status changes kept on the user
+const StatusHistoryLimit = 20
+
+var ErrStatusTransition = errors.New("status transition not allowed")
+
+// StatusChange records a transition of the account status.
+type StatusChange struct {
+	From      string    `bson:"from" json:"from"`
+	To        string    `bson:"to" json:"to"`
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedBy string    `bson:"changed_by,omitempty" json:"changed_by,omitempty"`
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at"`
+}
+
+// ValidStatus reports whether status is known.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an account can change from one status to
+// the other.
+func CanTransition(from, to string) bool {
+	return slices.Contains(statusTransitions[from], to)
+}
+
+// NewStatusChange returns the change of user to status, made by changedBy,
+// which is empty for changes the system makes.
+func NewStatusChange(user *User, status, reason, changedBy string) (StatusChange, error) {
+	if !CanTransition(user.Status, status) {
+		return StatusChange{}, ErrStatusTransition
+	}
+
+	return StatusChange{
+		From:      user.Status,
+		To:        status,
+		Reason:    reason,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	}, nil
+}
+
+// UsableStatus is the status an account returns to when a block on it is
+// lifted.
+func (u *User) UsableStatus() string {
+	if u.EmailVerified {
+		return StatusActive
+	}
+	return StatusPending
+}
+
+// StatusBeforeDeletion is the status a deleted account is restored to.
+func (u *User) StatusBeforeDeletion() string {
+	for i := len(u.StatusHistory) - 1; i >= 0; i-- {
+		if change := u.StatusHistory[i]; change.To == StatusDeleted && change.From != StatusDeleted {
+			return change.From
+		}
+	}
+
+	return u.UsableStatus()
+}
@@ -1,6 +1,9 @@
 package domain
 
 import (
+	"errors"
+	"io"
+	"strconv"
 	"time"
 )
 
@@ -11,22 +14,279 @@ type User struct {
 	Name      string    `bson:"name"`
 	CreatedAt time.Time `bson:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at"`
-	DeletedAt time.Time `bson:"deleted_at"`
+	DeletedAt time.Time `bson:"deleted_at,omitempty"`
+
+	// Version is incremented by every change clients can see, and is
+	// exposed to them as the ETag
+	Version int64 `bson:"version,omitempty"`
+
+	// Optional profile details, missing from older documents
+	AvatarURL string `bson:"avatar_url,omitempty"`
+	Phone     string `bson:"phone,omitempty"`
+	Locale    string `bson:"locale,omitempty"`
+	Timezone  string `bson:"timezone,omitempty"`
+	Bio       string `bson:"bio,omitempty"`
+
+	// Custom attributes, each described by an AttributeDefinition
+	Attributes map[string]string `bson:"attributes,omitempty"`
+
+	// Uploaded profile picture, AvatarURL can still point elsewhere
+	Avatar *Avatar `bson:"avatar,omitempty"`
+
+	// Roles decide what the user may do to other accounts
+	Roles []string `bson:"roles,omitempty"`
+
+	// Status is where the account is in its lifecycle, see Status*. The
+	// latest transitions are kept in StatusHistory.
+	Status          string         `bson:"status"`
+	StatusReason    string         `bson:"status_reason,omitempty"`
+	StatusChangedAt time.Time      `bson:"status_changed_at,omitempty"`
+	StatusChangedBy string         `bson:"status_changed_by,omitempty"`
+	StatusHistory   []StatusChange `bson:"status_history,omitempty"`
+
+	// Set when an operator forces a password reset, cleared by the next
+	// password change
+	PasswordResetRequired bool `bson:"password_reset_required,omitempty"`
+
+	EmailVerified   bool      `bson:"email_verified"`
+	EmailVerifiedAt time.Time `bson:"email_verified_at,omitempty"`
+
+	// Access tokens issued before this time are rejected
+	TokensValidAfter time.Time `bson:"tokens_valid_after,omitempty"`
+
+	// TOTP multi-factor authentication. The secret is stored while enrollment
+	// is pending and MFAEnabled is only set once a code has been confirmed.
+	MFAEnabled       bool     `bson:"mfa_enabled"`
+	MFASecret        string   `bson:"mfa_secret,omitempty"`
+	MFALastStep      int64    `bson:"mfa_last_step,omitempty"`
+	MFARecoveryCodes []string `bson:"mfa_recovery_codes,omitempty"`
 }
 
 type UserRepository interface {
 	Create(user *User) error
 	FindByID(id string) (*User, error)
 	FindByEmail(email string) (*User, error)
-	Update(user *User) error
-	SoftDelete(id string) error
+	FindDeletedByEmail(email string) (*User, error)
+	FindDeletedByID(id string) (*User, error)
+	UpdateFields(id string, version int64, fields map[string]interface{}) error
+	RemoveAttribute(key string) error
+	UpdateMFA(user *User) error
+	UpdatePassword(id, hashedPassword string) error
+	MarkEmailVerified(id string) error
+	SetStatus(id string, change StatusChange) error
+	UpdateEmail(id, email string) error
+	SetTokensValidAfter(id string, t time.Time) error
+	SetRoles(id string, roles []string) error
+	RequirePasswordReset(id string) error
+	UseMFAStep(id string, step int64) (bool, error)
+	UseRecoveryCode(id, codeHash string) (bool, error)
 	Delete(id string) error
-	List(page, limit int, nameFilter, emailFilter string) ([]*User, int, error)
+	List(opts ListOptions) (*UserPage, error)
+	ListDeleted(page, limit int) ([]*User, int, error)
+	ListDeletedBefore(t time.Time) ([]*User, error)
+}
+
+// Fields users can be sorted by
+const (
+	SortByCreatedAt = "created_at"
+	SortByName      = "name"
+	SortByEmail     = "email"
+)
+
+// Sort orders
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ErrInvalidListOptions is wrapped by errors caused by list options the
+// caller sent, such as an unknown sort field or a malformed page token.
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions selects a page of users. PageToken continues after the page
+// it was returned with; without it Page selects a page by offset. Tokens are
+// only valid with the sort and filters they were issued for.
+//
+// NameFilter matches the start of the name, EmailFilter the whole address
+// and Query whole words of the name. Zero values do not filter.
+type ListOptions struct {
+	Page          int
+	Limit         int
+	PageToken     string
+	NameFilter    string
+	EmailFilter   string
+	Query         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Status        string
+	Role          string
+	SortBy        string
+	SortOrder     string
+	SkipTotal     bool
+}
+
+// UserPage is a page of users. Total is 0 when it was not counted and
+// NextPageToken is empty on the last page.
+type UserPage struct {
+	Users         []*User
+	Total         int
+	NextPageToken string
+}
+
+// EmailChange is a pending change of address. It is applied only once the
+// token sent to the new address is confirmed.
+type EmailChange struct {
+	ID        string    `bson:"_id,omitempty"`
+	UserID    string    `bson:"user_id"`
+	OldEmail  string    `bson:"old_email"`
+	NewEmail  string    `bson:"new_email"`
+	TokenHash string    `bson:"token_hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	UsedAt    time.Time `bson:"used_at,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+type EmailChangeRepository interface {
+	Create(change *EmailChange) error
+	Use(tokenHash string) (*EmailChange, error)
+	InvalidateForUser(userID string) error
+	DeleteForUser(userID string) error
+}
+
+// TokenRevoker signs a user out of every session.
+type TokenRevoker interface {
+	LogoutAll(userID string) error
+}
+
+// Profile fields that can be updated, named like their update mask paths
+const (
+	FieldName       = "name"
+	FieldEmail      = "email"
+	FieldAvatarURL  = "avatar_url"
+	FieldPhone      = "phone"
+	FieldLocale     = "locale"
+	FieldTimezone   = "timezone"
+	FieldBio        = "bio"
+	FieldAttributes = "attributes"
+)
+
+// ProfileUpdate applies the fields of Profile listed in Paths. A listed
+// field left empty is cleared. Without Paths every non-empty field is
+// applied. The path "attributes" replaces every custom attribute, while
+// "attributes.<key>" only sets or clears one of them.
+type ProfileUpdate struct {
+	Paths   []string
+	Profile User
+
+	// Only update the profile while it still has this ETag, if set
+	IfMatch string
+}
+
+// AnyVersion updates a user regardless of its version.
+const AnyVersion int64 = -1
+
+var ErrVersionConflict = errors.New("user was modified concurrently, fetch it again and retry")
+
+var ErrInvalidETag = errors.New("invalid etag")
+
+// ETag identifies the version of the user.
+func (u *User) ETag() string {
+	return `"` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// ParseETag returns the version an ETag identifies.
+func ParseETag(etag string) (int64, error) {
+	unquoted, err := strconv.Unquote(etag)
+	if err != nil {
+		return 0, ErrInvalidETag
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 0 {
+		return 0, ErrInvalidETag
+	}
+
+	return version, nil
+}
+
+// Avatar is an uploaded profile picture. Every upload gets a new ID, and
+// each of its sizes is kept in the blob store under AvatarKey.
+type Avatar struct {
+	ID          string    `bson:"id" json:"id"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Sizes an avatar is stored in. The original is scaled down to at most 1024
+// pixels a side, the others are square thumbnails of that many pixels.
+const (
+	AvatarOriginal = "original"
+	AvatarLarge    = "256"
+	AvatarSmall    = "64"
+)
+
+var ErrInvalidAvatar = errors.New("invalid avatar")
+
+// AvatarKey returns the blob key of one size of an avatar.
+func AvatarKey(userID, avatarID, size string) string {
+	return "avatars/" + userID + "/" + avatarID + "/" + size
+}
+
+// AvatarImage is one size of an avatar.
+type AvatarImage struct {
+	ContentType string
+	Data        []byte
+}
+
+// PersonalDataSource holds data about a user outside the users collection.
+// Every source contributes named sections to personal data exports.
+type PersonalDataSource interface {
+	PersonalData(user *User) (map[string]interface{}, error)
+}
+
+// UserDataPurger holds data about a user outside the users collection that
+// is removed when the account is permanently deleted.
+type UserDataPurger interface {
+	PurgeUserData(user *User) error
+}
+
+// AccountPurger permanently deletes soft deleted accounts together with
+// everything stored about them.
+type AccountPurger interface {
+	Purge(user *User) error
+	PurgeDeletedAccounts() (int, error)
+	RunAccountPurger(interval time.Duration)
+}
+
+// AuditLogger records actions taken on accounts.
+type AuditLogger interface {
+	Audit(actorID, action, targetID, details string) error
+}
+
+// Audited actions of the user service
+const AuditActionExportData = "export_data"
+
+// Formats of personal data exports
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+// DataExport is a downloadable archive of everything held about a user.
+type DataExport struct {
+	Filename    string
+	ContentType string
+	Data        []byte
 }
 
 type UserUsecase interface {
 	GetProfile(userID string) (*User, error)
-	UpdateProfile(userID, name string) (*User, error)
+	UpdateProfile(userID string, update ProfileUpdate) (*User, error)
+	UploadAvatar(userID, contentType string, r io.Reader) (*User, error)
+	GetAvatar(userID, size string) (*AvatarImage, error)
+	RequestEmailChange(userID, newEmail string) error
+	ConfirmEmailChange(userID, token string) (*User, error)
 	DeleteProfile(userID string) error
-	ListUsers(page, limit int, nameFilter, emailFilter string) ([]*User, int, error)
+	ListUsers(opts ListOptions) (*UserPage, error)
+	ExportMyData(userID, format string) (*DataExport, error)
 }
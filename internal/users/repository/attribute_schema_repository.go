@@ -0,0 +1,89 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type attributeSchemaRepository struct {
+	coll *mongo.Collection
+}
+
+func NewAttributeSchemaRepository(db *mongo.Database) domain.AttributeSchemaRepository {
+	return &attributeSchemaRepository{
+		coll: db.Collection("attributeSchema"),
+	}
+}
+
+func (r *attributeSchemaRepository) List() ([]*domain.AttributeDefinition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cursor, err := r.coll.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var defs []*domain.AttributeDefinition
+	if err := cursor.All(ctx, &defs); err != nil {
+		return nil, err
+	}
+
+	return defs, nil
+}
+
+// Find returns nil when the attribute is not defined.
+func (r *attributeSchemaRepository) Find(key string) (*domain.AttributeDefinition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var def domain.AttributeDefinition
+	err := r.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&def)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &def, nil
+}
+
+// Save creates the definition or replaces the one with the same key.
+func (r *attributeSchemaRepository) Save(def *domain.AttributeDefinition) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	def.UpdatedAt = time.Now()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.coll.ReplaceOne(ctx, bson.M{"_id": def.Key}, def, opts)
+	return err
+}
+
+func (r *attributeSchemaRepository) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.coll.DeleteOne(ctx, bson.M{"_id": key})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
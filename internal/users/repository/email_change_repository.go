@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type emailChangeRepository struct {
+	coll *mongo.Collection
+}
+
+func NewEmailChangeRepository(db *mongo.Database) domain.EmailChangeRepository {
+	coll := db.Collection("emailChanges")
+
+	// Create indexes for token lookups and expiry
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	coll.Indexes().CreateMany(ctx, indexes)
+
+	return &emailChangeRepository{
+		coll: coll,
+	}
+}
+
+func (r *emailChangeRepository) Create(change *domain.EmailChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	change.CreatedAt = time.Now()
+
+	_, err := r.coll.InsertOne(ctx, change)
+	return err
+}
+
+// Use atomically marks an unused, unexpired change as used and returns it.
+// It returns nil when no such change exists.
+func (r *emailChangeRepository) Use(tokenHash string) (*domain.EmailChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"used_at": now},
+	}
+
+	var change domain.EmailChange
+	err := r.coll.FindOneAndUpdate(ctx, filter, update).Decode(&change)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+func (r *emailChangeRepository) InvalidateForUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "used_at": nil}
+	update := bson.M{
+		"$set": bson.M{"used_at": time.Now()},
+	}
+
+	_, err := r.coll.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// DeleteForUser removes every email change of the user, used or not.
+func (r *emailChangeRepository) DeleteForUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,120 @@
+package mongo
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userCursor is the position of the last user of a page in a sort order.
+// Page tokens are its base64 encoded JSON form. Filters is a hash of the
+// filters of the page, so a token cannot continue a different listing.
+type userCursor struct {
+	SortBy    string `json:"s"`
+	SortOrder string `json:"o"`
+	Filters   string `json:"f"`
+	Value     string `json:"v"`
+	ID        string `json:"i"`
+
+	value interface{}
+	oid   primitive.ObjectID
+}
+
+// listFiltersHash hashes the filters of opts, with times in UTC so the same
+// instant sent in another zone gives the same hash.
+func listFiltersHash(opts domain.ListOptions) string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal([]string{
+		opts.NameFilter,
+		opts.EmailFilter,
+		opts.Query,
+		opts.Status,
+		opts.Role,
+		formatTime(opts.CreatedAfter),
+		formatTime(opts.CreatedBefore),
+	})
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func encodeUserCursor(user *domain.User, opts domain.ListOptions) (string, error) {
+	c := userCursor{SortBy: opts.SortBy, SortOrder: opts.SortOrder, Filters: listFiltersHash(opts), ID: user.ID}
+
+	switch opts.SortBy {
+	case domain.SortByCreatedAt:
+		c.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case domain.SortByName:
+		c.Value = user.Name
+	case domain.SortByEmail:
+		c.Value = user.Email
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeUserCursor(token string, opts domain.ListOptions) (*userCursor, error) {
+	invalid := fmt.Errorf("%w: malformed page token", domain.ErrInvalidListOptions)
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var c userCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, invalid
+	}
+
+	if c.SortBy != opts.SortBy || c.SortOrder != opts.SortOrder {
+		return nil, fmt.Errorf("%w: page token was issued for a different sort order", domain.ErrInvalidListOptions)
+	}
+
+	if c.Filters != listFiltersHash(opts) {
+		return nil, fmt.Errorf("%w: page token was issued for different filters", domain.ErrInvalidListOptions)
+	}
+
+	if c.oid, err = primitive.ObjectIDFromHex(c.ID); err != nil {
+		return nil, invalid
+	}
+
+	c.value = c.Value
+	if opts.SortBy == domain.SortByCreatedAt {
+		if c.value, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return nil, invalid
+		}
+	}
+
+	return &c, nil
+}
+
+// filter matches the users after the cursor in its sort order.
+func (c *userCursor) filter() []bson.M {
+	op := "$gt"
+	if c.SortOrder == domain.SortDesc {
+		op = "$lt"
+	}
+
+	return []bson.M{
+		{c.SortBy: bson.M{op: c.value}},
+		{c.SortBy: c.value, "_id": bson.M{op: c.oid}},
+	}
+}
@@ -0,0 +1,109 @@
+package mongo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	user := &domain.User{ID: "665f1c2e9b1d4a3f8c7e6d5a", Name: "Ada", Email: "ada@example.com", CreatedAt: created}
+
+	tests := []struct {
+		sortBy string
+		want   interface{}
+	}{
+		{domain.SortByCreatedAt, created},
+		{domain.SortByName, "Ada"},
+		{domain.SortByEmail, "ada@example.com"},
+	}
+
+	for _, tt := range tests {
+		opts := domain.ListOptions{SortBy: tt.sortBy, SortOrder: domain.SortAsc, NameFilter: "A"}
+
+		token, err := encodeUserCursor(user, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := decodeUserCursor(token, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sortBy, err)
+		}
+		if c.oid.Hex() != user.ID {
+			t.Errorf("%s: id = %s, want %s", tt.sortBy, c.oid.Hex(), user.ID)
+		}
+		if got, ok := c.value.(time.Time); ok {
+			if !got.Equal(created) {
+				t.Errorf("%s: value = %v, want %v", tt.sortBy, got, created)
+			}
+		} else if c.value != tt.want {
+			t.Errorf("%s: value = %v, want %v", tt.sortBy, c.value, tt.want)
+		}
+	}
+}
+
+func TestUserCursorRejectsOtherListings(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	issued := domain.ListOptions{
+		SortBy:       domain.SortByName,
+		SortOrder:    domain.SortAsc,
+		NameFilter:   "A",
+		Status:       domain.StatusActive,
+		CreatedAfter: after,
+	}
+
+	token, err := encodeUserCursor(&domain.User{ID: "665f1c2e9b1d4a3f8c7e6d5a", Name: "Ada"}, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(opts *domain.ListOptions)
+	}{
+		{"sort field", func(o *domain.ListOptions) { o.SortBy = domain.SortByEmail }},
+		{"sort order", func(o *domain.ListOptions) { o.SortOrder = domain.SortDesc }},
+		{"name filter", func(o *domain.ListOptions) { o.NameFilter = "B" }},
+		{"email filter", func(o *domain.ListOptions) { o.EmailFilter = "ada@example.com" }},
+		{"query", func(o *domain.ListOptions) { o.Query = "ada" }},
+		{"status", func(o *domain.ListOptions) { o.Status = domain.StatusSuspended }},
+		{"role", func(o *domain.ListOptions) { o.Role = "admin" }},
+		{"created after", func(o *domain.ListOptions) { o.CreatedAfter = after.Add(time.Second) }},
+		{"created before", func(o *domain.ListOptions) { o.CreatedBefore = after.Add(time.Hour) }},
+		{"filter removed", func(o *domain.ListOptions) { o.NameFilter = "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := issued
+			tt.change(&opts)
+
+			if _, err := decodeUserCursor(token, opts); !errors.Is(err, domain.ErrInvalidListOptions) {
+				t.Errorf("err = %v, want ErrInvalidListOptions", err)
+			}
+		})
+	}
+
+	// The same instant in another zone is the same filter, and paging
+	// options are not filters
+	same := issued
+	same.CreatedAfter = after.In(time.FixedZone("UTC+2", 2*60*60))
+	same.Limit, same.SkipTotal = 50, true
+	if _, err := decodeUserCursor(token, same); err != nil {
+		t.Errorf("equal filters rejected: %v", err)
+	}
+}
+
+func TestUserCursorMalformed(t *testing.T) {
+	opts := domain.ListOptions{SortBy: domain.SortByCreatedAt, SortOrder: domain.SortDesc}
+
+	for _, token := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		if _, err := decodeUserCursor(token, opts); !errors.Is(err, domain.ErrInvalidListOptions) {
+			t.Errorf("token %q: err = %v, want ErrInvalidListOptions", token, err)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package mongo
 
 import (
 	"context"
+	"errors"
+	"log"
+	"regexp"
 	"time"
 
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/rbac"
 	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -30,12 +34,28 @@ func NewUserRepository(db *mongo.Database) domain.UserRepository {
 			Options: options.Index().SetUnique(true),
 		},
 		{
-			Keys: bson.D{{Key: "name", Value: 1}},
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}},
+		},
+		{
+			Keys: bson.D{{Key: "roles", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}},
 		},
 	}
 
 	coll.Indexes().CreateMany(ctx, indexes)
 
+	if err := migrateStatus(coll); err != nil {
+		log.Printf("Failed to migrate user statuses: %v", err)
+	}
+
 	return &userRepository{
 		db:   db,
 		coll: coll,
@@ -48,6 +68,7 @@ func (r *userRepository) Create(user *domain.User) error {
 
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	user.Version = 1
 
 	result, err := r.coll.InsertOne(ctx, user)
 	if err != nil {
@@ -93,30 +114,208 @@ func (r *userRepository) FindByEmail(email string) (*domain.User, error) {
 	return &user, nil
 }
 
-func (r *userRepository) Update(user *domain.User) error {
+// FindDeletedByEmail returns the most recently soft deleted user with the
+// email address.
+func (r *userRepository) FindDeletedByEmail(email string) (*domain.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	oid, err := primitive.ObjectIDFromHex(user.ID)
+	filter := bson.M{"email": email, "deleted_at": bson.M{"$ne": nil}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	var user domain.User
+	err := r.coll.FindOne(ctx, filter, opts).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindDeletedByID returns the user with the id if it was soft deleted.
+func (r *userRepository) FindDeletedByID(id string) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var user domain.User
+	err = r.coll.FindOne(ctx, bson.M{"_id": oid, "deleted_at": bson.M{"$ne": nil}}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	user.ID = oid.Hex()
+	return &user, nil
+}
+
+// UpdateFields sets the given fields, clearing those with a nil value. Unless
+// version is domain.AnyVersion the user is only updated while still at that
+// version, otherwise domain.ErrVersionConflict is returned.
+func (r *userRepository) UpdateFields(id string, version int64, fields map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
 
-	user.UpdatedAt = time.Now()
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	for field, value := range fields {
+		if value == nil {
+			unset[field] = ""
+			continue
+		}
+		set[field] = value
+	}
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	filter := bson.M{"_id": oid, "deleted_at": nil}
+	if version != domain.AnyVersion {
+		// Documents written before versioning have no version field
+		if version == 0 {
+			filter["version"] = bson.M{"$exists": false}
+		} else {
+			filter["version"] = version
+		}
+	}
+
+	result, err := r.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return r.conflictOrMissing(ctx, bson.M{"_id": oid, "deleted_at": nil})
+	}
+
+	return nil
+}
+
+// SetStatus applies a status change if the user still has the status it
+// changes from, otherwise domain.ErrVersionConflict is returned. Deleting
+// and restoring also sets and clears deleted_at.
+func (r *userRepository) SetStatus(id string, change domain.StatusChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"status":            change.To,
+		"status_changed_at": change.ChangedAt,
+		"updated_at":        time.Now(),
+	}
+	unset := bson.M{}
+
+	optional := bson.M{"status_reason": change.Reason, "status_changed_by": change.ChangedBy}
+	for field, value := range optional {
+		if value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+
+	if change.To == domain.StatusDeleted {
+		set["deleted_at"] = change.ChangedAt
+	}
+	if change.From == domain.StatusDeleted {
+		unset["deleted_at"] = ""
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$push": bson.M{
+			"status_history": bson.M{
+				"$each":  bson.A{change},
+				"$slice": -domain.StatusHistoryLimit,
+			},
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	filter := bson.M{"_id": oid, "status": change.From}
+	result, err := r.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return r.conflictOrMissing(ctx, bson.M{"_id": oid})
+	}
+
+	return nil
+}
+
+// conflictOrMissing tells a conditional update that lost a race, when the
+// user matching filter still exists, apart from one of a missing user.
+func (r *userRepository) conflictOrMissing(ctx context.Context, filter bson.M) error {
+	count, err := r.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return domain.ErrVersionConflict
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+// RemoveAttribute clears a custom attribute from every account, including
+// deleted ones.
+func (r *userRepository) RemoveAttribute(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	field := "attributes." + key
+	update := bson.M{
+		"$unset": bson.M{field: ""},
+		"$inc":   bson.M{"version": 1},
+	}
+
+	_, err := r.coll.UpdateMany(ctx, bson.M{field: bson.M{"$exists": true}}, update)
+	return err
+}
+
+func (r *userRepository) UpdatePassword(id, hashedPassword string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
 
 	update := bson.M{
 		"$set": bson.M{
-			"name": user.Name,
-			// "email":      user.Email,
-			"updated_at": user.UpdatedAt,
+			"password":   hashedPassword,
+			"updated_at": time.Now(),
 		},
+		"$unset": bson.M{"password_reset_required": ""},
 	}
 
 	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
 	return err
 }
 
-func (r *userRepository) SoftDelete(id string) error {
+func (r *userRepository) MarkEmailVerified(id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -125,17 +324,23 @@ func (r *userRepository) SoftDelete(id string) error {
 		return err
 	}
 
+	now := time.Now()
 	update := bson.M{
 		"$set": bson.M{
-			"deleted_at": time.Now(),
+			"email_verified":    true,
+			"email_verified_at": now,
+			"updated_at":        now,
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
 	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
 	return err
 }
 
-func (r *userRepository) Delete(id string) error {
+// UpdateEmail switches the user to a new, already confirmed address. The
+// unique index on email rejects addresses taken in the meantime.
+func (r *userRepository) UpdateEmail(id, email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -144,22 +349,339 @@ func (r *userRepository) Delete(id string) error {
 		return err
 	}
 
-	_, err = r.coll.DeleteOne(ctx, bson.M{"_id": oid})
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"email":             email,
+			"email_verified":    true,
+			"email_verified_at": now,
+			"updated_at":        now,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.New("email already in use")
+	}
 	return err
 }
 
-func (r *userRepository) List(page, limit int, nameFilter, emailFilter string) ([]*domain.User, int, error) {
+func (r *userRepository) SetTokensValidAfter(id string, t time.Time) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{"tokens_valid_after": t},
+	}
+
+	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+func (r *userRepository) SetRoles(id string, roles []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"roles":      roles,
+			"updated_at": time.Now(),
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+func (r *userRepository) RequirePasswordReset(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"password_reset_required": true,
+			"updated_at":              time.Now(),
+		},
+	}
+
+	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+func (r *userRepository) UpdateMFA(user *domain.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled":        user.MFAEnabled,
+			"mfa_secret":         user.MFASecret,
+			"mfa_last_step":      user.MFALastStep,
+			"mfa_recovery_codes": user.MFARecoveryCodes,
+			"updated_at":         user.UpdatedAt,
+		},
+	}
+
+	_, err = r.coll.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+// UseMFAStep records step as the last accepted TOTP time step. It returns
+// false when the step, or a later one, was already used so a code cannot be
+// replayed.
+func (r *userRepository) UseMFAStep(id string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{
+		"_id": oid,
+		"$or": []bson.M{
+			{"mfa_last_step": bson.M{"$lt": step}},
+			{"mfa_last_step": nil},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"mfa_last_step": step},
+	}
+
+	result, err := r.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes a recovery code hash from the user so each code
+// works only once. It returns false when the code is unknown.
+func (r *userRepository) UseRecoveryCode(id, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"_id": oid, "mfa_recovery_codes": codeHash}
+	update := bson.M{
+		"$pull": bson.M{"mfa_recovery_codes": codeHash},
+	}
+
+	result, err := r.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *userRepository) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.coll.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// List returns a page of users sorted by opts.SortBy with _id breaking
+// ties. Pages after the first are found by their position in that order
+// rather than by offset, so they stay stable while users are added.
+func (r *userRepository) List(opts domain.ListOptions) (*domain.UserPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := listFilter(opts)
+	page := &domain.UserPage{}
+
+	// Count total documents unless the caller does not need them
+	if !opts.SkipTotal {
+		total, err := r.coll.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = int(total)
+	}
+
+	direction := 1
+	if opts.SortOrder == domain.SortDesc {
+		direction = -1
+	}
+
+	// Fetch one extra user to learn whether there is a next page
+	findOpts := options.Find().
+		SetLimit(int64(opts.Limit + 1)).
+		SetSort(bson.D{{Key: opts.SortBy, Value: direction}, {Key: "_id", Value: direction}})
+
+	if opts.PageToken != "" {
+		after, err := decodeUserCursor(opts.PageToken, opts)
+		if err != nil {
+			return nil, err
+		}
+		filter["$or"] = after.filter()
+	} else if opts.Page > 1 {
+		findOpts.SetSkip(int64((opts.Page - 1) * opts.Limit))
+	}
+
+	cursor, err := r.coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user domain.User
+		if err := cursor.Decode(&user); err != nil {
+			continue
+		}
+
+		if oid, ok := cursor.Current.Lookup("_id").ObjectIDOK(); ok {
+			user.ID = oid.Hex()
+		}
+
+		page.Users = append(page.Users, &user)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Users) > opts.Limit {
+		page.Users = page.Users[:opts.Limit]
+
+		last := page.Users[len(page.Users)-1]
+		page.NextPageToken, err = encodeUserCursor(last, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+func (r *userRepository) ListDeleted(page, limit int) ([]*domain.User, int, error) {
+	filter := bson.M{"deleted_at": bson.M{"$ne": nil}}
+
+	return r.list(filter, page, limit, "deleted_at")
+}
+
+// listFilter matches the users selected by the filters of opts. Every
+// filter can be served by an index.
+func listFilter(opts domain.ListOptions) bson.M {
 	filter := bson.M{"deleted_at": nil}
-	if nameFilter != "" {
-		filter["name"] = bson.M{"$regex": nameFilter, "$options": "i"}
+
+	// An anchored, case sensitive prefix is the only regex that uses the
+	// name index. User input is escaped so it is matched literally.
+	if opts.NameFilter != "" {
+		filter["name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(opts.NameFilter)}
+	}
+	if opts.EmailFilter != "" {
+		filter["email"] = opts.EmailFilter
+	}
+	if opts.Query != "" {
+		filter["$text"] = bson.M{"$search": opts.Query}
+	}
+
+	created := bson.M{}
+	if !opts.CreatedAfter.IsZero() {
+		created["$gte"] = opts.CreatedAfter
+	}
+	if !opts.CreatedBefore.IsZero() {
+		created["$lt"] = opts.CreatedBefore
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	if opts.Status != "" {
+		filter["status"] = opts.Status
+	}
+
+	// Accounts created before roles existed have none and act as users
+	if opts.Role == rbac.RoleUser {
+		filter["roles"] = bson.M{"$in": bson.A{rbac.RoleUser, nil}}
+	} else if opts.Role != "" {
+		filter["roles"] = opts.Role
 	}
-	if emailFilter != "" {
-		filter["email"] = bson.M{"$regex": emailFilter, "$options": "i"}
+
+	return filter
+}
+
+// ListDeletedBefore returns the users soft deleted before t.
+func (r *userRepository) ListDeletedBefore(t time.Time) ([]*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := r.coll.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": t}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*domain.User
+	for cursor.Next(ctx) {
+		var user domain.User
+		if err := cursor.Decode(&user); err != nil {
+			continue
+		}
+
+		if oid, ok := cursor.Current.Lookup("_id").ObjectIDOK(); ok {
+			user.ID = oid.Hex()
+		}
+
+		users = append(users, &user)
 	}
 
+	return users, cursor.Err()
+}
+
+// list returns a page of the users matching filter, newest first by
+// sortField.
+func (r *userRepository) list(filter bson.M, page, limit int, sortField string) ([]*domain.User, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
 	// Count total documents
 	total, err := r.coll.CountDocuments(ctx, filter)
 	if err != nil {
@@ -173,7 +695,7 @@ func (r *userRepository) List(page, limit int, nameFilter, emailFilter string) (
 	opts := options.Find().
 		SetSkip(int64(skip)).
 		SetLimit(int64(limit)).
-		SetSort(bson.D{{Key: "created_at", Value: -1}})
+		SetSort(bson.D{{Key: sortField, Value: -1}})
 
 	cursor, err := r.coll.Find(ctx, filter, opts)
 	if err != nil {
@@ -197,3 +719,71 @@ func (r *userRepository) List(page, limit int, nameFilter, emailFilter string) (
 
 	return users, int(total), nil
 }
+
+// migrateStatus gives accounts created before statuses existed the status
+// their other fields imply, and drops the suspension fields it replaces.
+func migrateStatus(coll *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	steps := []struct {
+		filter bson.M
+		set    bson.M
+	}{
+		{
+			// Restoring a suspended account must not lift the suspension
+			filter: bson.M{"deleted_at": bson.M{"$ne": nil}, "suspended": true},
+			set: bson.M{
+				"status":            domain.StatusDeleted,
+				"status_changed_at": "$deleted_at",
+				"status_history": bson.A{bson.M{
+					"from":       domain.StatusSuspended,
+					"to":         domain.StatusDeleted,
+					"changed_at": "$deleted_at",
+				}},
+			},
+		},
+		{
+			filter: bson.M{"deleted_at": bson.M{"$ne": nil}},
+			set:    bson.M{"status": domain.StatusDeleted, "status_changed_at": "$deleted_at"},
+		},
+		{
+			filter: bson.M{"suspended": true},
+			set: bson.M{
+				"status":            domain.StatusSuspended,
+				"status_reason":     "$suspend_reason",
+				"status_changed_at": "$suspended_at",
+				"status_changed_by": "$suspended_by",
+			},
+		},
+		{
+			filter: bson.M{"email_verified": bson.M{"$ne": true}},
+			set:    bson.M{"status": domain.StatusPending, "status_changed_at": "$created_at"},
+		},
+		{
+			filter: bson.M{},
+			set:    bson.M{"status": domain.StatusActive, "status_changed_at": "$created_at"},
+		},
+	}
+
+	for _, step := range steps {
+		step.filter["status"] = bson.M{"$exists": false}
+		pipeline := mongo.Pipeline{{{Key: "$set", Value: step.set}}}
+
+		if _, err := coll.UpdateMany(ctx, step.filter, pipeline); err != nil {
+			return err
+		}
+	}
+
+	update := bson.M{
+		"$unset": bson.M{
+			"suspended":      "",
+			"suspended_at":   "",
+			"suspended_by":   "",
+			"suspend_reason": "",
+		},
+	}
+
+	_, err := coll.UpdateMany(ctx, bson.M{"suspended": bson.M{"$exists": true}}, update)
+	return err
+}
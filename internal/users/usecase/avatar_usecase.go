@@ -0,0 +1,262 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // GIF uploads are decoded and stored as PNG
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/blobstore"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// Content types accepted for avatars, as detected from the data
+var avatarContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+const (
+	// Largest width or height decoded, bounding the memory an upload takes
+	maxAvatarDimension = 4096
+	// Largest width or height of the stored original
+	avatarOriginalSize = 1024
+)
+
+// Square thumbnail sizes in pixels
+var avatarThumbnails = map[string]int{
+	domain.AvatarLarge: 256,
+	domain.AvatarSmall: 64,
+}
+
+// UploadAvatar reads an image of at most the configured size from r and
+// stores it with its thumbnails. The image is re-encoded, which also drops
+// metadata such as the location a photo was taken at.
+func (u *userUsecase) UploadAvatar(userID, contentType string, r io.Reader) (*domain.User, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, u.avatarMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > u.avatarMaxSize {
+		return nil, fmt.Errorf("%w: image must be at most %d bytes", domain.ErrInvalidAvatar, u.avatarMaxSize)
+	}
+
+	// Trust the data, not the declared type
+	detected := http.DetectContentType(data)
+	if !avatarContentTypes[detected] {
+		return nil, fmt.Errorf("%w: image must be a JPEG, PNG or GIF", domain.ErrInvalidAvatar)
+	}
+
+	if contentType != "" && contentType != detected {
+		return nil, fmt.Errorf("%w: content type %s does not match the image", domain.ErrInvalidAvatar, contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image cannot be decoded", domain.ErrInvalidAvatar)
+	}
+
+	if config.Width > maxAvatarDimension || config.Height > maxAvatarDimension {
+		return nil, fmt.Errorf("%w: image must be at most %d pixels wide and high", domain.ErrInvalidAvatar, maxAvatarDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image cannot be decoded", domain.ErrInvalidAvatar)
+	}
+
+	id, err := securetoken.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Photos stay JPEG, anything that may be transparent becomes PNG
+	avatar := &domain.Avatar{
+		ID:          id,
+		ContentType: "image/png",
+		UpdatedAt:   time.Now(),
+	}
+	if detected == "image/jpeg" {
+		avatar.ContentType = "image/jpeg"
+	}
+
+	images := map[string]image.Image{
+		domain.AvatarOriginal: fitImage(img, avatarOriginalSize),
+	}
+	for size, pixels := range avatarThumbnails {
+		images[size] = thumbnail(img, pixels)
+	}
+
+	for size, img := range images {
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, img, avatar.ContentType); err != nil {
+			return nil, err
+		}
+
+		if err := u.avatars.Put(domain.AvatarKey(user.ID, avatar.ID, size), &buf); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := u.userRepo.UpdateFields(user.ID, domain.AnyVersion, map[string]interface{}{"avatar": avatar}); err != nil {
+		return nil, err
+	}
+
+	// The previous avatar is no longer referenced
+	if user.Avatar != nil {
+		u.deleteAvatar(user.ID, user.Avatar)
+	}
+
+	user, err = u.userRepo.FindByID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clear password before returning
+	user.Password = ""
+	return user, nil
+}
+
+// GetAvatar returns one size of the avatar of a user, the original when size
+// is empty.
+func (u *userUsecase) GetAvatar(userID, size string) (*domain.AvatarImage, error) {
+	if size == "" {
+		size = domain.AvatarOriginal
+	}
+
+	if _, ok := avatarThumbnails[size]; !ok && size != domain.AvatarOriginal {
+		return nil, fmt.Errorf("%w: unknown size %q", domain.ErrInvalidAvatar, size)
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.Avatar == nil {
+		return nil, errors.New("user has no avatar")
+	}
+
+	blob, err := u.avatars.Get(domain.AvatarKey(user.ID, user.Avatar.ID, size))
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, errors.New("user has no avatar")
+		}
+		return nil, err
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AvatarImage{
+		ContentType: user.Avatar.ContentType,
+		Data:        data,
+	}, nil
+}
+
+// deleteAvatar removes every size of an avatar. Failures only leave unused
+// blobs behind, so they are logged.
+func (u *userUsecase) deleteAvatar(userID string, avatar *domain.Avatar) {
+	for _, size := range avatarSizes() {
+		if err := u.avatars.Delete(domain.AvatarKey(userID, avatar.ID, size)); err != nil {
+			log.Printf("Failed to delete avatar %s of user %s: %v", avatar.ID, userID, err)
+		}
+	}
+}
+
+// avatarSizes returns every size an avatar is stored in.
+func avatarSizes() []string {
+	sizes := []string{domain.AvatarOriginal}
+	for size := range avatarThumbnails {
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+func encodeImage(w io.Writer, img image.Image, contentType string) error {
+	if contentType == "image/jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	}
+	return png.Encode(w, img)
+}
+
+// fitImage scales img down, keeping its aspect ratio, so neither side is
+// longer than size. Smaller images are returned unchanged.
+func fitImage(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= size && b.Dy() <= size {
+		return img
+	}
+
+	width, height := size, b.Dy()*size/b.Dx()
+	if b.Dy() > b.Dx() {
+		width, height = b.Dx()*size/b.Dy(), size
+	}
+
+	return resize(img, b, max(width, 1), max(height, 1))
+}
+
+// thumbnail crops the center square of img and scales it to size pixels a
+// side.
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	return resize(img, image.Rect(x, y, x+side, y+side), size, size)
+}
+
+// resize scales the src area of img to width by height pixels. Each pixel
+// is the average of the source pixels it covers, which keeps downscaled
+// images smooth.
+func resize(img image.Image, src image.Rectangle, width, height int) *image.RGBA64 {
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := src.Min.Y + y*src.Dy()/height
+		y1 := max(src.Min.Y+(y+1)*src.Dy()/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := src.Min.X + x*src.Dx()/width
+			x1 := max(src.Min.X+(x+1)*src.Dx()/width, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,216 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// exportManifest describes the contents of a personal data export.
+type exportManifest struct {
+	UserID      string          `json:"user_id"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Format      string          `json:"format"`
+	Sections    []exportSection `json:"sections"`
+}
+
+type exportSection struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+}
+
+// ExportMyData gathers everything held about the user into a JSON document
+// or a ZIP archive with one file per section. Both carry a manifest.
+func (u *userUsecase) ExportMyData(userID, format string) (*domain.DataExport, error) {
+	if format == "" {
+		format = domain.ExportFormatJSON
+	}
+
+	if format != domain.ExportFormatJSON && format != domain.ExportFormatZIP {
+		return nil, errors.New("unsupported export format")
+	}
+
+	// Check the rate limit before the work, but only count exports that
+	// were assembled
+	if err := u.checkExportLimit(u.exportLimiter.Peek, userID); err != nil {
+		return nil, err
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	sections := map[string]interface{}{"profile": exportProfile(user)}
+	for _, source := range u.dataSources {
+		data, err := source.PersonalData(user)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range data {
+			sections[name] = value
+		}
+	}
+
+	now := time.Now().UTC()
+	manifest := exportManifest{
+		UserID:      user.ID,
+		GeneratedAt: now,
+		Format:      format,
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	export := &domain.DataExport{
+		Filename: fmt.Sprintf("data-export-%s-%s.%s", user.ID, now.Format("20060102T150405Z"), format),
+	}
+
+	switch format {
+	case domain.ExportFormatJSON:
+		for _, name := range names {
+			manifest.Sections = append(manifest.Sections, exportSection{Name: name})
+		}
+
+		export.ContentType = "application/json"
+		export.Data, err = json.MarshalIndent(map[string]interface{}{
+			"manifest": manifest,
+			"data":     sections,
+		}, "", "  ")
+	case domain.ExportFormatZIP:
+		export.ContentType = "application/zip"
+		export.Data, err = exportZIP(manifest, names, sections)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.checkExportLimit(u.exportLimiter.Allow, userID); err != nil {
+		return nil, err
+	}
+
+	// Exports are audited like operator actions
+	if err := u.auditLogger.Audit(user.ID, domain.AuditActionExportData, user.ID, format); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// checkExportLimit returns a LimitError when check, the Peek or Allow of
+// the export limiter, denies an export of the user.
+func (u *userUsecase) checkExportLimit(check func(key string) (ratelimit.Result, error), userID string) error {
+	result, err := check(userID)
+	if err != nil {
+		return err
+	}
+
+	if !result.Allowed {
+		return &ratelimit.LimitError{
+			Message:    "too many data exports, please try again later",
+			RetryAfter: result.RetryAfter,
+		}
+	}
+
+	return nil
+}
+
+func exportZIP(manifest exportManifest, names []string, sections map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for _, name := range names {
+		file := name + ".json"
+		manifest.Sections = append(manifest.Sections, exportSection{Name: name, File: file})
+
+		if err := writeZIPJSON(archive, file, sections[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeZIPJSON(archive, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeZIPJSON(archive *zip.Writer, name string, value interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// exportProfile returns the profile without credentials and secrets.
+func exportProfile(user *domain.User) map[string]interface{} {
+	profile := map[string]interface{}{
+		"id":             user.ID,
+		"email":          user.Email,
+		"name":           user.Name,
+		"created_at":     user.CreatedAt,
+		"updated_at":     user.UpdatedAt,
+		"email_verified": user.EmailVerified,
+		"roles":          user.Roles,
+		"mfa_enabled":    user.MFAEnabled,
+		"status":         user.Status,
+	}
+
+	optional := map[string]string{
+		"avatar_url": user.AvatarURL,
+		"phone":      user.Phone,
+		"locale":     user.Locale,
+		"timezone":   user.Timezone,
+		"bio":        user.Bio,
+	}
+	for key, value := range optional {
+		if value != "" {
+			profile[key] = value
+		}
+	}
+
+	if len(user.Attributes) > 0 {
+		profile["attributes"] = user.Attributes
+	}
+
+	if user.Avatar != nil {
+		profile["avatar"] = user.Avatar
+	}
+
+	if !user.EmailVerifiedAt.IsZero() {
+		profile["email_verified_at"] = user.EmailVerifiedAt
+	}
+
+	if user.StatusReason != "" {
+		profile["status_reason"] = user.StatusReason
+	}
+
+	if len(user.StatusHistory) > 0 {
+		profile["status_history"] = user.StatusHistory
+	}
+
+	return profile
+}
@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func TestExportFailuresKeepQuota(t *testing.T) {
+	tu := newTestUsecase(t, 1)
+
+	// Neither a missing user nor a failing data source uses up the export
+	if _, err := tu.ExportMyData("missing", domain.ExportFormatJSON); err == nil {
+		t.Fatal("exported a missing user")
+	}
+
+	tu.source.err = errors.New("unavailable")
+	if _, err := tu.ExportMyData("u1", domain.ExportFormatJSON); err == nil {
+		t.Fatal("exported although a data source failed")
+	}
+
+	tu.source.err = nil
+	if _, err := tu.ExportMyData("u1", domain.ExportFormatZIP); err != nil {
+		t.Fatalf("export after failures: %v", err)
+	}
+}
+
+func TestExportLimitCheckedBeforeWork(t *testing.T) {
+	tu := newTestUsecase(t, 2)
+
+	for i := range 2 {
+		if _, err := tu.ExportMyData("u1", domain.ExportFormatJSON); err != nil {
+			t.Fatalf("export %d: %v", i+1, err)
+		}
+	}
+
+	calls := tu.source.calls
+	_, err := tu.ExportMyData("u1", domain.ExportFormatJSON)
+	var limitErr *ratelimit.LimitError
+	if !errors.As(err, &limitErr) || limitErr.RetryAfter <= 0 {
+		t.Fatalf("err = %v, want a LimitError with a retry delay", err)
+	}
+	if tu.source.calls != calls {
+		t.Error("an export over the limit was assembled")
+	}
+}
@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+// fakeUserRepo keeps users in memory.
+type fakeUserRepo struct {
+	domain.UserRepository
+	users map[string]*domain.User
+}
+
+func (r *fakeUserRepo) FindByID(id string) (*domain.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) FindByEmail(email string) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (r *fakeUserRepo) UpdateFields(id string, version int64, fields map[string]interface{}) error {
+	user, ok := r.users[id]
+	if !ok {
+		return errors.New("not found")
+	}
+	if version != domain.AnyVersion && version != user.Version {
+		return domain.ErrVersionConflict
+	}
+
+	if name, ok := fields[domain.FieldName]; ok {
+		user.Name = name.(string)
+	}
+	user.Version++
+	return nil
+}
+
+func (r *fakeUserRepo) ListDeletedBefore(t time.Time) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, user := range r.users {
+		if !user.DeletedAt.IsZero() && user.DeletedAt.Before(t) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) Delete(id string) error {
+	if _, ok := r.users[id]; !ok {
+		return errors.New("not found")
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// fakeEmailChangeRepo counts the pending email changes of every user.
+type fakeEmailChangeRepo struct {
+	domain.EmailChangeRepository
+	changes map[string]int
+}
+
+func (r *fakeEmailChangeRepo) Create(change *domain.EmailChange) error {
+	r.changes[change.UserID]++
+	return nil
+}
+
+func (r *fakeEmailChangeRepo) InvalidateForUser(userID string) error {
+	return nil
+}
+
+func (r *fakeEmailChangeRepo) DeleteForUser(userID string) error {
+	delete(r.changes, userID)
+	return nil
+}
+
+type fakeAttributeRepo struct {
+	domain.AttributeSchemaRepository
+	defs []*domain.AttributeDefinition
+}
+
+func (r *fakeAttributeRepo) List() ([]*domain.AttributeDefinition, error) {
+	return r.defs, nil
+}
+
+type fakeNotifier struct {
+	sent []notify.Message
+}
+
+func (n *fakeNotifier) Send(msg notify.Message) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+type fakeAuditLogger struct {
+	actions []string
+}
+
+func (l *fakeAuditLogger) Audit(actorID, action, targetID, details string) error {
+	l.actions = append(l.actions, action)
+	return nil
+}
+
+// fakeDataSource is a service keeping personal data of users, which it
+// exports and purges.
+type fakeDataSource struct {
+	calls  int
+	purged []string
+	err    error
+}
+
+func (s *fakeDataSource) PersonalData(user *domain.User) (map[string]interface{}, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return map[string]interface{}{"sessions": []string{"s1"}}, nil
+}
+
+func (s *fakeDataSource) PurgeUserData(user *domain.User) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.purged = append(s.purged, user.ID)
+	return nil
+}
+
+// testUsecase is a userUsecase with its fakes.
+type testUsecase struct {
+	*userUsecase
+	users        *fakeUserRepo
+	emailChanges *fakeEmailChangeRepo
+	notifier     *fakeNotifier
+	source       *fakeDataSource
+}
+
+// newTestUsecase returns a usecase with the users u1 and u2, allowing
+// exportLimit data exports an hour.
+func newTestUsecase(t *testing.T, exportLimit int) *testUsecase {
+	t.Helper()
+
+	limiter, err := ratelimit.New(ratelimit.FixedWindow, "export", exportLimit, time.Hour, ratelimit.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tu := &testUsecase{
+		users: &fakeUserRepo{users: map[string]*domain.User{
+			"u1": {ID: "u1", Name: "Ada", Email: "ada@example.com", Version: 3},
+			"u2": {ID: "u2", Name: "Bob", Email: "bob@example.com", Version: 1},
+		}},
+		emailChanges: &fakeEmailChangeRepo{changes: map[string]int{}},
+		notifier:     &fakeNotifier{},
+		source:       &fakeDataSource{},
+	}
+	tu.userUsecase = &userUsecase{
+		userRepo:        tu.users,
+		emailChangeRepo: tu.emailChanges,
+		attributeRepo: &fakeAttributeRepo{defs: []*domain.AttributeDefinition{
+			{Key: "team", Type: domain.AttributeString},
+		}},
+		notifier:      tu.notifier,
+		auditLogger:   &fakeAuditLogger{},
+		exportLimiter: limiter,
+		dataSources:   []domain.PersonalDataSource{tu.source},
+	}
+	return tu
+}
@@ -0,0 +1,198 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // Timezones are validated even where the host has no zoneinfo
+	"unicode/utf8"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+
+	"golang.org/x/text/language"
+)
+
+// profileField validates the new value of a profile field and returns it as
+// stored, or nil to clear the field.
+type profileField func(profile *domain.User) (interface{}, error)
+
+// Fields UpdateProfile can write directly. The email address is not listed
+// because it changes only once confirmed, nor are custom attributes, which
+// are checked against the attribute schema.
+var profileFields = map[string]profileField{
+	domain.FieldName:      validateName,
+	domain.FieldAvatarURL: validateAvatarURL,
+	domain.FieldPhone:     validatePhone,
+	domain.FieldLocale:    validateLocale,
+	domain.FieldTimezone:  validateTimezone,
+	domain.FieldBio:       validateBio,
+}
+
+const (
+	maxNameLength      = 100
+	maxAvatarURLLength = 2048
+	maxBioLength       = 500
+)
+
+// Phone numbers are stored in E.164 format
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// validateName stores a cleared name as "" rather than removing the field,
+// so every user keeps a name to sort and page by.
+func validateName(profile *domain.User) (interface{}, error) {
+	name := strings.TrimSpace(profile.Name)
+	if name == "" {
+		return "", nil
+	}
+
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return nil, errors.New("name must be at most 100 characters long")
+	}
+
+	return name, nil
+}
+
+func validateAvatarURL(profile *domain.User) (interface{}, error) {
+	avatarURL := strings.TrimSpace(profile.AvatarURL)
+	if avatarURL == "" {
+		return nil, nil
+	}
+
+	if len(avatarURL) > maxAvatarURLLength {
+		return nil, errors.New("avatar URL must be at most 2048 characters long")
+	}
+
+	u, err := url.Parse(avatarURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, errors.New("avatar URL must be an absolute http or https URL")
+	}
+
+	return u.String(), nil
+}
+
+func validatePhone(profile *domain.User) (interface{}, error) {
+	// Separators are accepted but not stored
+	phone := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(profile.Phone)
+	if phone == "" {
+		return nil, nil
+	}
+
+	if !phonePattern.MatchString(phone) {
+		return nil, errors.New("phone number must be in international format, such as +14155552671")
+	}
+
+	return phone, nil
+}
+
+func validateLocale(profile *domain.User) (interface{}, error) {
+	locale := strings.TrimSpace(profile.Locale)
+	if locale == "" {
+		return nil, nil
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, errors.New("locale must be a BCP 47 language tag, such as en-US")
+	}
+
+	return tag.String(), nil
+}
+
+func validateTimezone(profile *domain.User) (interface{}, error) {
+	timezone := strings.TrimSpace(profile.Timezone)
+	if timezone == "" {
+		return nil, nil
+	}
+
+	// Local names the zone of the server, not one of the user
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+		return nil, errors.New("timezone must be an IANA time zone, such as Europe/Berlin")
+	}
+
+	return timezone, nil
+}
+
+func validateBio(profile *domain.User) (interface{}, error) {
+	bio := strings.TrimSpace(profile.Bio)
+	if bio == "" {
+		return nil, nil
+	}
+
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return nil, errors.New("bio must be at most 500 characters long")
+	}
+
+	return bio, nil
+}
+
+// validateAttributes checks every attribute against its definition and
+// returns them as stored, or nil when there are none.
+func validateAttributes(attributes map[string]string, schema map[string]*domain.AttributeDefinition) (interface{}, error) {
+	stored := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		normalized, err := validateAttribute(key, value, schema)
+		if err != nil {
+			return nil, err
+		}
+		if normalized != nil {
+			stored[key] = normalized.(string)
+		}
+	}
+
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	return stored, nil
+}
+
+// validateAttribute checks one attribute and returns it as stored, or nil to
+// clear it.
+func validateAttribute(key, value string, schema map[string]*domain.AttributeDefinition) (interface{}, error) {
+	def, ok := schema[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown attribute %q", key)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	return def.Normalize(value)
+}
+
+// presentProfileFields returns the paths of the non-empty fields of profile.
+// Custom attributes are listed one by one, so they are merged with the
+// attributes already set.
+func presentProfileFields(profile *domain.User) []string {
+	var paths []string
+	present := []struct {
+		path  string
+		value string
+	}{
+		{domain.FieldName, profile.Name},
+		{domain.FieldEmail, profile.Email},
+		{domain.FieldAvatarURL, profile.AvatarURL},
+		{domain.FieldPhone, profile.Phone},
+		{domain.FieldLocale, profile.Locale},
+		{domain.FieldTimezone, profile.Timezone},
+		{domain.FieldBio, profile.Bio},
+	}
+	for _, field := range present {
+		if field.value != "" {
+			paths = append(paths, field.path)
+		}
+	}
+
+	for key, value := range profile.Attributes {
+		if value != "" {
+			paths = append(paths, domain.FieldAttributes+"."+key)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr bool
+	}{
+		{"trimmed", "  Ada Lovelace ", "Ada Lovelace", false},
+		// A cleared name is stored, not removed, so sorting by name still
+		// finds the user
+		{"cleared", "", "", false},
+		{"blank", "   ", "", false},
+		{"longest", strings.Repeat("é", maxNameLength), strings.Repeat("é", maxNameLength), false},
+		{"too long", strings.Repeat("a", maxNameLength+1), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateName(&domain.User{Name: tt.input})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
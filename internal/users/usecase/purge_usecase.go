@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"log"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/blobstore"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+type accountPurger struct {
+	userRepo        domain.UserRepository
+	emailChangeRepo domain.EmailChangeRepository
+	avatars         blobstore.BlobStore
+	grace           time.Duration
+	purgers         []domain.UserDataPurger
+}
+
+// PurgerDeps holds what the account purger is built from.
+type PurgerDeps struct {
+	UserRepo        domain.UserRepository
+	EmailChangeRepo domain.EmailChangeRepository
+	Avatars         blobstore.BlobStore
+
+	// Grace is how long soft deleted accounts are kept
+	Grace time.Duration
+
+	// Purgers remove the data held outside the users service
+	Purgers []domain.UserDataPurger
+}
+
+// NewAccountPurger returns the purger of accounts soft deleted more than
+// deps.Grace ago.
+func NewAccountPurger(deps PurgerDeps) domain.AccountPurger {
+	return &accountPurger{
+		userRepo:        deps.UserRepo,
+		emailChangeRepo: deps.EmailChangeRepo,
+		avatars:         deps.Avatars,
+		grace:           deps.Grace,
+		purgers:         deps.Purgers,
+	}
+}
+
+// Purge permanently deletes the account of a soft deleted user: the data
+// of every source, pending email changes, every size of the avatar and
+// finally the user itself, so a purge that fails can be run again.
+func (p *accountPurger) Purge(user *domain.User) error {
+	for _, purger := range p.purgers {
+		if err := purger.PurgeUserData(user); err != nil {
+			return err
+		}
+	}
+
+	if err := p.emailChangeRepo.DeleteForUser(user.ID); err != nil {
+		return err
+	}
+
+	if user.Avatar != nil {
+		for _, size := range avatarSizes() {
+			if err := p.avatars.Delete(domain.AvatarKey(user.ID, user.Avatar.ID, size)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.userRepo.Delete(user.ID)
+}
+
+// PurgeDeletedAccounts purges the accounts whose grace period has ended.
+func (p *accountPurger) PurgeDeletedAccounts() (int, error) {
+	users, err := p.userRepo.ListDeletedBefore(time.Now().Add(-p.grace))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := p.Purge(user); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// RunAccountPurger calls PurgeDeletedAccounts every interval. It never
+// returns.
+func (p *accountPurger) RunAccountPurger(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := p.PurgeDeletedAccounts()
+		if err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		}
+
+		if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+	}
+}
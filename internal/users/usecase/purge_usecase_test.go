@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/blobstore"
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func putAvatar(t *testing.T, store blobstore.BlobStore, userID, avatarID string) {
+	t.Helper()
+	for _, size := range avatarSizes() {
+		if err := store.Put(domain.AvatarKey(userID, avatarID, size), strings.NewReader("image")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func avatarExists(store blobstore.BlobStore, userID, avatarID string) []string {
+	var found []string
+	for _, size := range avatarSizes() {
+		r, err := store.Get(domain.AvatarKey(userID, avatarID, size))
+		if err == nil {
+			r.Close()
+			found = append(found, size)
+		}
+	}
+	return found
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	avatars, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	users := &fakeUserRepo{users: map[string]*domain.User{
+		"expired": {ID: "expired", DeletedAt: now.Add(-48 * time.Hour), Avatar: &domain.Avatar{ID: "a1"}},
+		"recent":  {ID: "recent", DeletedAt: now.Add(-time.Hour), Avatar: &domain.Avatar{ID: "a2"}},
+		"bare":    {ID: "bare", DeletedAt: now.Add(-48 * time.Hour)},
+		"active":  {ID: "active"},
+	}}
+	emailChanges := &fakeEmailChangeRepo{changes: map[string]int{"expired": 2, "recent": 1}}
+	source := &fakeDataSource{}
+
+	putAvatar(t, avatars, "expired", "a1")
+	putAvatar(t, avatars, "recent", "a2")
+
+	purger := NewAccountPurger(PurgerDeps{
+		UserRepo:        users,
+		EmailChangeRepo: emailChanges,
+		Avatars:         avatars,
+		Grace:           24 * time.Hour,
+		Purgers:         []domain.UserDataPurger{source},
+	})
+
+	purged, err := purger.PurgeDeletedAccounts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("purged %d accounts, want 2", purged)
+	}
+
+	for _, id := range []string{"expired", "bare"} {
+		if _, ok := users.users[id]; ok {
+			t.Errorf("user %s was not deleted", id)
+		}
+	}
+	for _, id := range []string{"recent", "active"} {
+		if _, ok := users.users[id]; !ok {
+			t.Errorf("user %s was deleted", id)
+		}
+	}
+
+	if found := avatarExists(avatars, "expired", "a1"); len(found) != 0 {
+		t.Errorf("avatar sizes %v of a purged user were kept", found)
+	}
+	if found := avatarExists(avatars, "recent", "a2"); len(found) != len(avatarSizes()) {
+		t.Errorf("avatar of a restorable user was deleted, only %v left", found)
+	}
+
+	if _, ok := emailChanges.changes["expired"]; ok {
+		t.Error("email changes of a purged user were kept")
+	}
+	if _, ok := emailChanges.changes["recent"]; !ok {
+		t.Error("email changes of a restorable user were deleted")
+	}
+
+	if len(source.purged) != 2 {
+		t.Errorf("data sources purged %v, want the two expired users", source.purged)
+	}
+}
+
+func TestPurgeKeepsUserWhenDataRemains(t *testing.T) {
+	avatars, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &fakeUserRepo{users: map[string]*domain.User{
+		"expired": {ID: "expired", DeletedAt: time.Now().Add(-48 * time.Hour)},
+	}}
+	source := &fakeDataSource{err: errors.New("unavailable")}
+
+	purger := NewAccountPurger(PurgerDeps{
+		UserRepo:        users,
+		EmailChangeRepo: &fakeEmailChangeRepo{},
+		Avatars:         avatars,
+		Grace:           24 * time.Hour,
+		Purgers:         []domain.UserDataPurger{source},
+	})
+
+	// The user is kept so the next run finds it again
+	if _, err := purger.PurgeDeletedAccounts(); err == nil {
+		t.Fatal("expected the failure of a data source")
+	}
+	if _, ok := users.users["expired"]; !ok {
+		t.Error("user was deleted although its data was not")
+	}
+}
@@ -2,18 +2,64 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
-	// "github.com/nightnice1st/testGridWhiz/internal/pkg/validator"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/blobstore"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/notify"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/ratelimit"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/rbac"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/securetoken"
+	"github.com/nightnice1st/testGridWhiz/internal/pkg/validator"
 	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
 )
 
 type userUsecase struct {
-	userRepo domain.UserRepository
+	userRepo          domain.UserRepository
+	emailChangeRepo   domain.EmailChangeRepository
+	attributeRepo     domain.AttributeSchemaRepository
+	notifier          notify.Notifier
+	tokenRevoker      domain.TokenRevoker
+	emailChangeExpiry time.Duration
+	avatars           blobstore.BlobStore
+	avatarMaxSize     int64
+	auditLogger       domain.AuditLogger
+	exportLimiter     ratelimit.Limiter
+	dataSources       []domain.PersonalDataSource
 }
 
-func NewUserUsecase(userRepo domain.UserRepository) domain.UserUsecase {
+// UserDeps holds what the user usecase is built from.
+type UserDeps struct {
+	UserRepo          domain.UserRepository
+	EmailChangeRepo   domain.EmailChangeRepository
+	AttributeRepo     domain.AttributeSchemaRepository
+	Notifier          notify.Notifier
+	TokenRevoker      domain.TokenRevoker
+	EmailChangeExpiry time.Duration
+	Avatars           blobstore.BlobStore
+	AvatarMaxSize     int64
+	AuditLogger       domain.AuditLogger
+	ExportLimiter     ratelimit.Limiter
+
+	// DataSources contribute the data held outside the users collection
+	// to personal data exports
+	DataSources []domain.PersonalDataSource
+}
+
+func NewUserUsecase(deps UserDeps) domain.UserUsecase {
 	return &userUsecase{
-		userRepo: userRepo,
+		userRepo:          deps.UserRepo,
+		emailChangeRepo:   deps.EmailChangeRepo,
+		attributeRepo:     deps.AttributeRepo,
+		notifier:          deps.Notifier,
+		tokenRevoker:      deps.TokenRevoker,
+		emailChangeExpiry: deps.EmailChangeExpiry,
+		avatars:           deps.Avatars,
+		avatarMaxSize:     deps.AvatarMaxSize,
+		auditLogger:       deps.AuditLogger,
+		exportLimiter:     deps.ExportLimiter,
+		dataSources:       deps.DataSources,
 	}
 }
 
@@ -28,35 +74,105 @@ func (u *userUsecase) GetProfile(userID string) (*domain.User, error) {
 	return user, nil
 }
 
-func (u *userUsecase) UpdateProfile(userID, name string) (*domain.User, error) {
+func (u *userUsecase) UpdateProfile(userID string, update domain.ProfileUpdate) (*domain.User, error) {
 	// Get existing user
-	user, err := u.userRepo.FindByID(userID)
+	existing, err := u.userRepo.FindByID(userID)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 
-	// Update fields if provided
-	if name != "" {
-		user.Name = name
+	// Fail before anything is changed when the caller's copy is stale, the
+	// update itself checks the version again
+	version := domain.AnyVersion
+	if update.IfMatch != "" {
+		if version, err = domain.ParseETag(update.IfMatch); err != nil {
+			return nil, err
+		}
+		if version != existing.Version {
+			return nil, domain.ErrVersionConflict
+		}
+	}
+
+	// Without a mask only the fields provided are updated
+	paths := update.Paths
+	if len(paths) == 0 {
+		paths = presentProfileFields(&update.Profile)
+	}
+
+	// Validate every field before changing any of them
+	fields := make(map[string]interface{})
+	changeEmail := false
+	var schema map[string]*domain.AttributeDefinition
+	for _, path := range paths {
+		if path == domain.FieldEmail {
+			if update.Profile.Email == "" {
+				return nil, errors.New("email cannot be cleared")
+			}
+			if err := u.checkEmailChange(existing, update.Profile.Email); err != nil {
+				return nil, err
+			}
+			changeEmail = true
+			continue
+		}
+
+		if path == domain.FieldAttributes || strings.HasPrefix(path, domain.FieldAttributes+".") {
+			if schema == nil {
+				if schema, err = u.attributeSchema(); err != nil {
+					return nil, err
+				}
+			}
+
+			var value interface{}
+			if key, ok := strings.CutPrefix(path, domain.FieldAttributes+"."); ok {
+				value, err = validateAttribute(key, update.Profile.Attributes[key], schema)
+			} else {
+				value, err = validateAttributes(update.Profile.Attributes, schema)
+			}
+			if err != nil {
+				return nil, err
+			}
+			fields[path] = value
+			continue
+		}
+
+		field, ok := profileFields[path]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q in update mask", path)
+		}
+
+		value, err := field(&update.Profile)
+		if err != nil {
+			return nil, err
+		}
+		fields[path] = value
 	}
 
-	// if email != "" && email != user.Email {
-	// 	// Validate new email
-	// 	if err := validator.ValidateEmail(email); err != nil {
-	// 		return nil, err
-	// 	}
+	// Replacing all attributes conflicts with changing one of them
+	if _, ok := fields[domain.FieldAttributes]; ok {
+		for path := range fields {
+			if strings.HasPrefix(path, domain.FieldAttributes+".") {
+				return nil, fmt.Errorf("update mask cannot contain both %q and %q", domain.FieldAttributes, path)
+			}
+		}
+	}
 
-	// 	// Check if email already exists
-	// 	existingUser, _ := u.userRepo.FindByEmail(email)
-	// 	if existingUser != nil && existingUser.ID != userID {
-	// 		return nil, errors.New("email already in use")
-	// 	}
+	if len(fields) > 0 {
+		if err := u.userRepo.UpdateFields(userID, version, fields); err != nil {
+			return nil, err
+		}
+	}
 
-	// 	user.Email = email
-	// }
+	// A new email address has to be confirmed before it is applied. It is
+	// only requested once the rest of the update is stored, so a rejected
+	// update sends no confirmation.
+	if changeEmail {
+		if err := u.RequestEmailChange(userID, update.Profile.Email); err != nil {
+			return nil, err
+		}
+	}
 
-	// Update in database
-	if err := u.userRepo.Update(user); err != nil {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
 		return nil, err
 	}
 
@@ -65,34 +181,230 @@ func (u *userUsecase) UpdateProfile(userID, name string) (*domain.User, error) {
 	return user, nil
 }
 
+// attributeSchema returns the attribute definitions by key.
+func (u *userUsecase) attributeSchema() (map[string]*domain.AttributeDefinition, error) {
+	defs, err := u.attributeRepo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(map[string]*domain.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		schema[def.Key] = def
+	}
+
+	return schema, nil
+}
+
+// RequestEmailChange starts a change of address. The new address receives a
+// confirmation token and the old one a notice; nothing changes until the
+// token is confirmed.
+func (u *userUsecase) RequestEmailChange(userID, newEmail string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if err := u.checkEmailChange(user, newEmail); err != nil {
+		return err
+	}
+
+	// Only the latest request can be confirmed
+	if err := u.emailChangeRepo.InvalidateForUser(userID); err != nil {
+		return err
+	}
+
+	token, err := securetoken.Generate()
+	if err != nil {
+		return err
+	}
+
+	err = u.emailChangeRepo.Create(&domain.EmailChange{
+		UserID:    userID,
+		OldEmail:  user.Email,
+		NewEmail:  newEmail,
+		TokenHash: securetoken.Hash(token),
+		ExpiresAt: time.Now().Add(u.emailChangeExpiry),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = u.notifier.Send(notify.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Use this token to confirm your new email address: %s\n"+
+			"It expires in %s.", token, u.emailChangeExpiry),
+	})
+	if err != nil {
+		return err
+	}
+
+	return u.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("A change of your account email address to %s was requested. "+
+			"If this was not you, change your password immediately.", newEmail),
+	})
+}
+
+// checkEmailChange validates a new address of user.
+func (u *userUsecase) checkEmailChange(user *domain.User, newEmail string) error {
+	if newEmail == user.Email {
+		return errors.New("new email is the same as the current email")
+	}
+
+	// Validate new email
+	if err := validator.ValidateEmail(newEmail); err != nil {
+		return err
+	}
+
+	// Check if email already exists
+	existingUser, _ := u.userRepo.FindByEmail(newEmail)
+	if existingUser != nil {
+		return errors.New("email already in use")
+	}
+
+	return nil
+}
+
+func (u *userUsecase) ConfirmEmailChange(userID, token string) (*domain.User, error) {
+	// Consume the confirmation token so it can only be used once
+	change, err := u.emailChangeRepo.Use(securetoken.Hash(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if change == nil || change.UserID != userID {
+		return nil, errors.New("invalid or expired confirmation token")
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// The account changed address since the request was made
+	if user.Email != change.OldEmail {
+		return nil, errors.New("invalid or expired confirmation token")
+	}
+
+	if err := u.userRepo.UpdateEmail(userID, change.NewEmail); err != nil {
+		return nil, err
+	}
+
+	// Existing tokens still carry the old email claim
+	if err := u.tokenRevoker.LogoutAll(userID); err != nil {
+		return nil, err
+	}
+
+	user, err = u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Confirming the new address also verifies it
+	if user.Status == domain.StatusPending {
+		statusChange, err := domain.NewStatusChange(user, domain.StatusActive, "email address verified", "")
+		if err != nil {
+			return nil, err
+		}
+
+		if err := u.userRepo.SetStatus(userID, statusChange); err != nil {
+			return nil, err
+		}
+		user.Status = statusChange.To
+	}
+
+	// Clear password before returning
+	user.Password = ""
+	return user, nil
+}
+
 func (u *userUsecase) DeleteProfile(userID string) error {
 	// Check if user exists
-	_, err := u.userRepo.FindByID(userID)
+	user, err := u.userRepo.FindByID(userID)
 	if err != nil {
 		return errors.New("user not found")
 	}
 
-	return u.userRepo.SoftDelete(userID)
+	change, err := domain.NewStatusChange(user, domain.StatusDeleted, "profile deleted", "")
+	if err != nil {
+		return err
+	}
+
+	if err := u.userRepo.SetStatus(userID, change); err != nil {
+		return err
+	}
+
+	return u.tokenRevoker.LogoutAll(userID)
 }
 
-func (u *userUsecase) ListUsers(page, limit int, nameFilter, emailFilter string) ([]*domain.User, int, error) {
-	if page < 1 {
-		page = 1
+func (u *userUsecase) ListUsers(opts domain.ListOptions) (*domain.UserPage, error) {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+
+	if opts.Limit < 1 || opts.Limit > 100 {
+		opts.Limit = 10
 	}
 
-	if limit < 1 || limit > 100 {
-		limit = 10
+	// Newest users first unless asked otherwise, other fields A to Z
+	switch opts.SortBy {
+	case "", domain.SortByCreatedAt:
+		opts.SortBy = domain.SortByCreatedAt
+		if opts.SortOrder == "" {
+			opts.SortOrder = domain.SortDesc
+		}
+	case domain.SortByName, domain.SortByEmail:
+		if opts.SortOrder == "" {
+			opts.SortOrder = domain.SortAsc
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown sort field %q", domain.ErrInvalidListOptions, opts.SortBy)
 	}
 
-	users, total, err := u.userRepo.List(page, limit, nameFilter, emailFilter)
+	if opts.SortOrder != domain.SortAsc && opts.SortOrder != domain.SortDesc {
+		return nil, fmt.Errorf("%w: unknown sort order %q", domain.ErrInvalidListOptions, opts.SortOrder)
+	}
+
+	if err := validateListFilters(opts); err != nil {
+		return nil, err
+	}
+
+	page, err := u.userRepo.List(opts)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
 	// Clear passwords before returning
-	for _, user := range users {
+	for _, user := range page.Users {
 		user.Password = ""
 	}
 
-	return users, total, nil
+	return page, nil
+}
+
+// Longest name filter or search query accepted
+const maxSearchLength = 100
+
+func validateListFilters(opts domain.ListOptions) error {
+	if len(opts.NameFilter) > maxSearchLength || len(opts.Query) > maxSearchLength {
+		return fmt.Errorf("%w: search text is too long", domain.ErrInvalidListOptions)
+	}
+
+	if !opts.CreatedAfter.IsZero() && !opts.CreatedBefore.IsZero() && !opts.CreatedAfter.Before(opts.CreatedBefore) {
+		return fmt.Errorf("%w: created_after must be before created_before", domain.ErrInvalidListOptions)
+	}
+
+	// Deleted accounts are listed by the admin service
+	if opts.Status != "" && (!domain.ValidStatus(opts.Status) || opts.Status == domain.StatusDeleted) {
+		return fmt.Errorf("%w: unknown status %q", domain.ErrInvalidListOptions, opts.Status)
+	}
+
+	if opts.Role != "" && !rbac.ValidRole(opts.Role) {
+		return fmt.Errorf("%w: unknown role %q", domain.ErrInvalidListOptions, opts.Role)
+	}
+
+	return nil
 }
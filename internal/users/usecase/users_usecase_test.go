@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nightnice1st/testGridWhiz/internal/users/domain"
+)
+
+func etag(version int64) string {
+	return (&domain.User{Version: version}).ETag()
+}
+
+func TestUpdateProfileRequestsEmailChangeAfterUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		update domain.ProfileUpdate
+	}{
+		{
+			name: "conflicting attribute paths",
+			update: domain.ProfileUpdate{
+				Paths: []string{domain.FieldEmail, domain.FieldAttributes, domain.FieldAttributes + ".team"},
+				Profile: domain.User{
+					Email:      "new@example.com",
+					Attributes: map[string]string{"team": "core"},
+				},
+			},
+		},
+		{
+			name: "stale version",
+			update: domain.ProfileUpdate{
+				Paths:   []string{domain.FieldEmail, domain.FieldName},
+				Profile: domain.User{Email: "new@example.com", Name: "Ada L."},
+				IfMatch: etag(2),
+			},
+		},
+		{
+			name: "invalid field",
+			update: domain.ProfileUpdate{
+				Paths:   []string{domain.FieldEmail, domain.FieldPhone},
+				Profile: domain.User{Email: "new@example.com", Phone: "not a phone"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tu := newTestUsecase(t, 1)
+
+			if _, err := tu.UpdateProfile("u1", tt.update); err == nil {
+				t.Fatal("expected the update to be rejected")
+			}
+			if tu.emailChanges.changes["u1"] != 0 || len(tu.notifier.sent) != 0 {
+				t.Errorf("a rejected update requested an email change, sent %v", tu.notifier.sent)
+			}
+			if tu.users.users["u1"].Version != 3 {
+				t.Error("a rejected update changed the user")
+			}
+		})
+	}
+}
+
+func TestUpdateProfileVersionConflictSendsNoEmail(t *testing.T) {
+	tu := newTestUsecase(t, 1)
+
+	// The user changes between the version check and the update
+	update := domain.ProfileUpdate{
+		Paths:   []string{domain.FieldEmail, domain.FieldName},
+		Profile: domain.User{Email: "new@example.com", Name: "Ada L."},
+		IfMatch: etag(3),
+	}
+	tu.userRepo = &conflictingUserRepo{fakeUserRepo: tu.users}
+
+	if _, err := tu.UpdateProfile("u1", update); !errors.Is(err, domain.ErrVersionConflict) {
+		t.Fatalf("err = %v, want ErrVersionConflict", err)
+	}
+	if tu.emailChanges.changes["u1"] != 0 || len(tu.notifier.sent) != 0 {
+		t.Errorf("a conflicting update requested an email change, sent %v", tu.notifier.sent)
+	}
+}
+
+// conflictingUserRepo loses every conditional update to a concurrent one.
+type conflictingUserRepo struct {
+	*fakeUserRepo
+}
+
+func (r *conflictingUserRepo) UpdateFields(id string, version int64, fields map[string]interface{}) error {
+	return domain.ErrVersionConflict
+}
+
+func TestUpdateProfileEmailChecksRunFirst(t *testing.T) {
+	tu := newTestUsecase(t, 1)
+
+	update := domain.ProfileUpdate{
+		Paths:   []string{domain.FieldName, domain.FieldEmail},
+		Profile: domain.User{Name: "Ada L.", Email: "bob@example.com"},
+	}
+	if _, err := tu.UpdateProfile("u1", update); err == nil {
+		t.Fatal("accepted an address in use")
+	}
+	if tu.users.users["u1"].Name != "Ada" {
+		t.Error("the name changed although the email address was rejected")
+	}
+	if tu.emailChanges.changes["u1"] != 0 {
+		t.Error("an email change was requested for an address in use")
+	}
+}
+
+func TestUpdateProfileWithEmailChange(t *testing.T) {
+	tu := newTestUsecase(t, 1)
+
+	update := domain.ProfileUpdate{
+		Paths:   []string{domain.FieldName, domain.FieldEmail},
+		Profile: domain.User{Name: "Ada L.", Email: "new@example.com"},
+		IfMatch: etag(3),
+	}
+	user, err := tu.UpdateProfile("u1", update)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if user.Name != "Ada L." || tu.users.users["u1"].Name != "Ada L." {
+		t.Errorf("name = %q, want the new name", user.Name)
+	}
+	// The address only changes once confirmed
+	if user.Email != "ada@example.com" {
+		t.Errorf("email = %q, want the old address until confirmed", user.Email)
+	}
+	if tu.emailChanges.changes["u1"] != 1 || len(tu.notifier.sent) != 2 {
+		t.Errorf("%d email changes and %d messages, want 1 and 2", tu.emailChanges.changes["u1"], len(tu.notifier.sent))
+	}
+}